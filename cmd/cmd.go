@@ -14,10 +14,18 @@ var errUnknownSubCommand = errors.New("unknown subcommand")
 
 // RunCmd parses the subcommand and chooses the behaviour
 func RunCmd(args []string) error {
-	subCmd := parseArgs(args)
+	subCmd, rest := parseArgs(args)
 	switch subCmd {
 	case "run":
 		return run()
+	case "upload":
+		return upload(rest)
+	case "history":
+		return showHistory(rest)
+	case "delete":
+		return deleteUpload(rest)
+	case "link":
+		return renewLink(rest)
 	case "start":
 		return newDefaultDaemon().start(getExecutable(), "run")
 	case "stop":
@@ -49,6 +57,14 @@ func printHelp() error {
 Usage: foxyshot [command]
 Available commands:
 	  run        Run foxyshot in foreground
+	  upload     Upload files or globs and print the links, e.g. foxyshot upload ~/Desktop/*.png
+	             Use - to read an image from stdin, e.g. grim - | foxyshot upload -
+	  history    List uploaded screenshots, flags: --since 24h|2006-01-02, --grep text, --json,
+	             --copy to copy the newest shown url to the clipboard
+	  delete     Delete an uploaded screenshot by key or url, or the newest one with --last,
+	             --destination name to delete only one copy
+	  link       Print a new presigned link to an uploaded screenshot by key or url, or the newest one
+	             with --last, flags: --duration 72h, --destination name
 	  configure  Configure foxyshot
 
 	  start      Start foxyshot daemon
@@ -64,15 +80,16 @@ Available flags:
 	return nil
 }
 
-func parseArgs(args []string) string {
+// parseArgs returns the subcommand and its arguments after the logging flags
+func parseArgs(args []string) (string, []string) {
 	if len(args) < 2 {
-		return "help"
+		return "help", nil
 	}
 
 	subCmd := args[1]
-	logger.FromArgs(args[2:])
+	rest := logger.FromArgs(args[2:])
 
-	return subCmd
+	return subCmd, rest
 }
 
 func getExecutable() string {
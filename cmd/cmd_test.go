@@ -23,17 +23,21 @@ func TestParseArgs(t *testing.T) {
 		args []string
 	}
 	tests := []struct {
-		name string
-		args args
-		want string
+		name     string
+		args     args
+		want     string
+		wantRest []string
 	}{
-		{"two valid args", args{args: []string{"arg", "expected-subcommand"}}, "expected-subcommand"},
-		{"one arg - expect help", args{args: []string{"arg"}}, "help"},
-		{"no args - expect help", args{}, "help"},
+		{"two valid args", args{args: []string{"arg", "expected-subcommand"}}, "expected-subcommand", []string{}},
+		{"one arg - expect help", args{args: []string{"arg"}}, "help", nil},
+		{"no args - expect help", args{}, "help", nil},
+		{"subcommand args", args{args: []string{"arg", "upload", "a.png", "b.png"}}, "upload", []string{"a.png", "b.png"}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.want, parseArgs(tt.args.args), "parseArgs(%v)", tt.args.args)
+			subCmd, rest := parseArgs(tt.args.args)
+			assert.Equalf(t, tt.want, subCmd, "parseArgs(%v)", tt.args.args)
+			assert.Equalf(t, tt.wantRest, rest, "parseArgs(%v)", tt.args.args)
 		})
 	}
 }
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/history"
+	"foxyshot/storage"
+)
+
+var errNothingToDelete = errors.New("nothing to delete, usage: foxyshot delete <key or url> or foxyshot delete --last")
+
+type deleteOptions struct {
+	target      string
+	last        bool
+	destination string
+}
+
+type uploadHistory interface {
+	Last() (history.Record, bool, error)
+	Find(keyOrURL string) (history.Record, bool, error)
+	MarkKeysRemoved(keys []string, removed time.Time) (int, error)
+	SetLink(id uint64, url string, expires time.Time) error
+}
+
+// keyFinder maps a link that is not in history to the destination and key of the screenshot
+type keyFinder func(destination, link string) (history.Location, bool)
+
+// remover deletes uploaded screenshots from every destination that stored them
+type remover struct {
+	newDeleter func(destination string) (storage.Deleter, error)
+	findKey    keyFinder
+	out        io.Writer
+	// history is nil if uploads are not recorded, then links are mapped to keys with findKey
+	history uploadHistory
+}
+
+func deleteUpload(args []string) error {
+	opts, err := parseDeleteArgs(args)
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("cannot load config, %w", err)
+	}
+	r := &remover{
+		newDeleter: func(destination string) (storage.Deleter, error) {
+			return storage.NewDeleter(appConfig, destination)
+		},
+		findKey: configKeyFinder(appConfig),
+		out:     os.Stdout,
+	}
+	if appConfig.History.Enabled {
+		if r.history, err = history.New(appConfig.History.Path); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return r.remove(ctx, opts)
+}
+
+func parseDeleteArgs(args []string) (deleteOptions, error) {
+	var opts deleteOptions
+	f := flag.NewFlagSet("delete", flag.ContinueOnError)
+	f.BoolVar(&opts.last, "last", false, "delete the newest upload from history")
+	f.StringVar(&opts.destination, "destination", "", "delete only from the destination with the name")
+	if err := f.Parse(args); err != nil {
+		return opts, err
+	}
+
+	switch {
+	case f.NArg() > 1:
+		return opts, errors.New("only one screenshot can be deleted at a time")
+	case f.NArg() == 1 && opts.last:
+		return opts, errors.New("use either --last or a key")
+	case f.NArg() == 1:
+		opts.target = f.Arg(0)
+	case !opts.last:
+		return opts, errNothingToDelete
+	}
+
+	return opts, nil
+}
+
+// remove deletes every copy of the screenshot and marks it in history if all of them are gone
+func (r *remover) remove(ctx context.Context, opts deleteOptions) error {
+	record, found, err := findUpload(r.history, opts.target, opts.last)
+	if err != nil {
+		return err
+	}
+
+	var locations []history.Location
+	if found {
+		locations = record.Locations()
+		if opts.destination != "" {
+			locations = onlyDestination(locations, opts.destination)
+		}
+		if len(locations) == 0 {
+			return fmt.Errorf("the screenshot was not uploaded to %s", opts.destination)
+		}
+	} else {
+		location, err := targetLocation(r.findKey, opts.destination, opts.target)
+		if err != nil {
+			return err
+		}
+		locations = []history.Location{location}
+	}
+
+	failed := 0
+	for _, l := range locations {
+		if err := r.delete(ctx, l); err != nil {
+			log.Printf("Cannot delete %s, %v \n", l.Key, err)
+			failed++
+
+			continue
+		}
+		_, _ = fmt.Fprintf(r.out, "Deleted %s\n", describe(l))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d copies were not deleted", failed, len(locations))
+	}
+
+	if !found || opts.destination != "" {
+		return nil
+	}
+	// deduplicated uploads of the same screenshot share the keys
+	keys := make([]string, 0, len(locations))
+	for _, l := range locations {
+		keys = append(keys, l.Key)
+	}
+	_, err = r.history.MarkKeysRemoved(keys, time.Now())
+
+	return err
+}
+
+// findUpload looks up the newest upload or the one with the key or link, h is nil if history is disabled
+// Targets that are not in history are not an error, targetLocation resolves them
+func findUpload(h uploadHistory, target string, last bool) (history.Record, bool, error) {
+	if h == nil {
+		if last {
+			return history.Record{}, false, errHistoryDisabled
+		}
+
+		return history.Record{}, false, nil
+	}
+
+	if last {
+		record, found, err := h.Last()
+		if err == nil && !found {
+			err = errors.New("history is empty")
+		}
+
+		return record, found, err
+	}
+
+	return h.Find(target)
+}
+
+func (r *remover) delete(ctx context.Context, l history.Location) error {
+	d, err := r.newDeleter(l.Destination)
+	if err != nil {
+		return err
+	}
+
+	return d.Delete(ctx, l.Key)
+}
+
+// targetLocation uses keys that are not in history as they are and maps links to keys with findKey
+func targetLocation(findKey keyFinder, destination, target string) (history.Location, error) {
+	if !strings.Contains(target, "://") {
+		return history.Location{Destination: destination, Key: target}, nil
+	}
+
+	if findKey != nil {
+		if l, ok := findKey(destination, target); ok {
+			if l.Destination == "" {
+				l.Destination = destination
+			}
+
+			return l, nil
+		}
+	}
+
+	return history.Location{}, fmt.Errorf("%s is not in history and does not match any destination, pass the key instead of the link", target)
+}
+
+// configKeyFinder recognizes links built by the configured destinations
+func configKeyFinder(c *config.Config) keyFinder {
+	return func(destination, link string) (history.Location, bool) {
+		name, key, ok := storage.KeyFromURL(c, destination, link)
+
+		return history.Location{Destination: name, Key: key}, ok
+	}
+}
+
+func onlyDestination(locations []history.Location, destination string) []history.Location {
+	var filtered []history.Location
+	for _, l := range locations {
+		if l.Destination == destination {
+			filtered = append(filtered, l)
+		}
+	}
+
+	return filtered
+}
+
+func describe(l history.Location) string {
+	if l.Destination == "" {
+		return l.Key
+	}
+
+	return fmt.Sprintf("%s from %s", l.Key, l.Destination)
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"foxyshot/history"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeleteArgs(t *testing.T) {
+	opts, err := parseDeleteArgs([]string{"--destination", "archive", "2023/shot.jpg"})
+	require.NoError(t, err)
+	assert.Equal(t, deleteOptions{target: "2023/shot.jpg", destination: "archive"}, opts)
+
+	opts, err = parseDeleteArgs([]string{"--last"})
+	require.NoError(t, err)
+	assert.True(t, opts.last)
+
+	_, err = parseDeleteArgs(nil)
+	assert.ErrorIs(t, err, errNothingToDelete)
+	_, err = parseDeleteArgs([]string{"--last", "shot.jpg"})
+	assert.EqualError(t, err, "use either --last or a key")
+	_, err = parseDeleteArgs([]string{"a.jpg", "b.jpg"})
+	assert.EqualError(t, err, "only one screenshot can be deleted at a time")
+}
+
+func TestRemover_Remove(t *testing.T) {
+	record := history.Record{
+		ID: 7, Key: "shot.jpg", Destination: "team", URL: "https://foxy/shot.jpg",
+		Copies: []history.Location{{Destination: "archive", Key: "archive/shot.jpg"}},
+	}
+
+	tests := []struct {
+		name        string
+		opts        deleteOptions
+		failing     string
+		wantDeleted []string
+		wantRemoved bool
+		wantErr     string
+	}{
+		{"every copy by url", deleteOptions{target: "https://foxy/shot.jpg"}, "", []string{"team:shot.jpg", "archive:archive/shot.jpg"}, true, ""},
+		{"last", deleteOptions{last: true}, "", []string{"team:shot.jpg", "archive:archive/shot.jpg"}, true, ""},
+		{"one destination", deleteOptions{target: "shot.jpg", destination: "archive"}, "", []string{"archive:archive/shot.jpg"}, false, ""},
+		{"key not in history", deleteOptions{target: "other.jpg"}, "", []string{":other.jpg"}, false, ""},
+		{"link not in history", deleteOptions{target: "https://cdn/2023/other.jpg"}, "", []string{"team:2023/other.jpg"}, false, ""},
+		{"unknown link", deleteOptions{target: "https://foxy/other.jpg"}, "", nil, false, "https://foxy/other.jpg is not in history and does not match any destination, pass the key instead of the link"},
+		{"failed copy", deleteOptions{target: "shot.jpg"}, "archive", []string{"team:shot.jpg"}, false, "1 of 2 copies were not deleted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &historyStub{record: record}
+			var deleted []string
+			r := &remover{
+				newDeleter: func(destination string) (storage.Deleter, error) {
+					return deleterFunc(func(_ context.Context, key string) error {
+						if tt.failing != "" && destination == tt.failing {
+							return errors.New("forbidden")
+						}
+						deleted = append(deleted, destination+":"+key)
+
+						return nil
+					}), nil
+				},
+				findKey: cdnKeyFinder,
+				out:     &bytes.Buffer{},
+				history: h,
+			}
+
+			err := r.remove(context.Background(), tt.opts)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantDeleted, deleted)
+			if tt.wantRemoved {
+				assert.Equal(t, []string{"shot.jpg", "archive/shot.jpg"}, h.removed)
+			} else {
+				assert.Empty(t, h.removed)
+			}
+		})
+	}
+}
+
+func TestRemover_RemoveWithoutHistory(t *testing.T) {
+	r := &remover{out: &bytes.Buffer{}}
+
+	assert.ErrorIs(t, r.remove(context.Background(), deleteOptions{last: true}), errHistoryDisabled)
+
+	var deleted string
+	r.newDeleter = func(destination string) (storage.Deleter, error) {
+		return deleterFunc(func(_ context.Context, key string) error {
+			deleted = destination + ":" + key
+
+			return nil
+		}), nil
+	}
+	r.findKey = cdnKeyFinder
+	require.NoError(t, r.remove(context.Background(), deleteOptions{target: "https://cdn/shot.jpg"}))
+	assert.Equal(t, "team:shot.jpg", deleted)
+}
+
+// cdnKeyFinder maps links of the team destination, the fragment of viewer links is ignored
+func cdnKeyFinder(_, link string) (history.Location, bool) {
+	link, _, _ = strings.Cut(link, "#")
+	key, ok := strings.CutPrefix(link, "https://cdn/")
+
+	return history.Location{Destination: "team", Key: key}, ok
+}
+
+type deleterFunc func(ctx context.Context, key string) error
+
+func (f deleterFunc) Delete(ctx context.Context, key string) error {
+	return f(ctx, key)
+}
+
+type historyStub struct {
+	record  history.Record
+	removed []string
+}
+
+func (h *historyStub) Last() (history.Record, bool, error) {
+	return h.record, true, nil
+}
+
+func (h *historyStub) Find(keyOrURL string) (history.Record, bool, error) {
+	for _, l := range h.record.Locations() {
+		if l.Key == keyOrURL {
+			return h.record, true, nil
+		}
+	}
+
+	return h.record, keyOrURL == h.record.URL, nil
+}
+
+func (h *historyStub) MarkKeysRemoved(keys []string, _ time.Time) (int, error) {
+	h.removed = keys
+
+	return 1, nil
+}
+
+func (h *historyStub) SetLink(id uint64, url string, expires time.Time) error {
+	if id == h.record.ID {
+		h.record.URL, h.record.Expires = url, expires
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/history"
+	"foxyshot/system/clipboard"
+)
+
+const dateLayout = "2006-01-02"
+
+var errHistoryDisabled = errors.New("history is disabled in config")
+
+type historyOptions struct {
+	filter history.Filter
+	json   bool
+	copy   bool
+}
+
+func showHistory(args []string) error {
+	opts, err := parseHistoryArgs(args, time.Now())
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("cannot load config, %w", err)
+	}
+	if !appConfig.History.Enabled {
+		return errHistoryDisabled
+	}
+	h, err := history.New(appConfig.History.Path)
+	if err != nil {
+		return err
+	}
+	records, err := h.List(opts.filter)
+	if err != nil {
+		return err
+	}
+
+	if err := printRecords(os.Stdout, records, opts.json); err != nil {
+		return err
+	}
+	if opts.copy && len(records) > 0 {
+		return clipboard.New().Copy(records[len(records)-1].URL)
+	}
+
+	return nil
+}
+
+func parseHistoryArgs(args []string, now time.Time) (historyOptions, error) {
+	var opts historyOptions
+	f := flag.NewFlagSet("history", flag.ContinueOnError)
+	since := f.String("since", "", "show uploads newer than a duration (24h) or a date (2006-01-02)")
+	f.StringVar(&opts.filter.Grep, "grep", "", "show uploads with the text in the path, key, destination or url")
+	f.BoolVar(&opts.json, "json", false, "print JSON lines instead of a table")
+	f.BoolVar(&opts.copy, "copy", false, "copy the newest shown url to the clipboard")
+	if err := f.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if *since != "" {
+		var err error
+		if opts.filter.Since, err = parseSince(*since, now); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(dateLayout, since, now.Location()); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid --since %q, use a duration like 24h or a date like %s", since, dateLayout)
+}
+
+func printRecords(out io.Writer, records []history.Record, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tDESTINATION\tURL\tSOURCE")
+	for _, r := range records {
+		url := r.URL
+		switch {
+		case !r.Removed.IsZero():
+			url += " (deleted)"
+		case !r.Expires.IsZero() && r.Expires.Before(time.Now()):
+			url += " (expired)"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Time.Format("2006-01-02 15:04"), r.Destination, url, r.Source)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"foxyshot/history"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHistoryArgs(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	opts, err := parseHistoryArgs([]string{"--since", "24h", "--grep", "invoice", "--json", "--copy"}, now)
+
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), opts.filter.Since)
+	assert.Equal(t, "invoice", opts.filter.Grep)
+	assert.True(t, opts.json)
+	assert.True(t, opts.copy)
+
+	opts, err = parseHistoryArgs([]string{"--since", "2023-05-01"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), opts.filter.Since)
+
+	_, err = parseHistoryArgs([]string{"--since", "yesterday"}, now)
+	assert.EqualError(t, err, `invalid --since "yesterday", use a duration like 24h or a date like 2006-01-02`)
+}
+
+func TestPrintRecords(t *testing.T) {
+	records := []history.Record{
+		{Time: time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC), Destination: "s3", URL: "https://foxy/1.jpg", Source: "/Desktop/shot.png"},
+		{Time: time.Date(2023, 5, 11, 12, 0, 0, 0, time.UTC), Destination: "s3", URL: "https://foxy/2.jpg", Expires: time.Now().Add(-time.Hour)},
+	}
+
+	table := &bytes.Buffer{}
+	require.NoError(t, printRecords(table, records, false))
+	assert.Equal(t, `TIME              DESTINATION  URL                           SOURCE
+2023-05-10 12:00  s3           https://foxy/1.jpg            /Desktop/shot.png
+2023-05-11 12:00  s3           https://foxy/2.jpg (expired)  
+`, table.String())
+
+	lines := &bytes.Buffer{}
+	require.NoError(t, printRecords(lines, records[:1], true))
+	assert.JSONEq(t, `{"id": 0, "time": "2023-05-10T12:00:00Z", "source": "/Desktop/shot.png", "key": "", "destination": "s3",
+		"url": "https://foxy/1.jpg", "size": 0, "expires": "0001-01-01T00:00:00Z",
+		"removed": "0001-01-01T00:00:00Z"}`, lines.String())
+}
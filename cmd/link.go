@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/history"
+	"foxyshot/storage"
+	"foxyshot/system/clipboard"
+)
+
+// maxLinkDuration is the longest expiration S3 accepts for presigned links
+const maxLinkDuration = 7 * 24 * time.Hour
+
+var errNothingToLink = errors.New("no screenshot, usage: foxyshot link <key or url> [--duration 72h] or foxyshot link --last")
+
+type linkOptions struct {
+	target      string
+	last        bool
+	destination string
+	duration    time.Duration
+}
+
+// linker regenerates expired links of uploaded screenshots
+type linker struct {
+	newPresigner func(destination string) (storage.Presigner, error)
+	findKey      keyFinder
+	clipboard    clipboardCopier
+	out          io.Writer
+	// history is nil if uploads are not recorded, then links are mapped to keys with findKey
+	history uploadHistory
+}
+
+func renewLink(args []string) error {
+	opts, err := parseLinkArgs(args)
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("cannot load config, %w", err)
+	}
+	l := &linker{
+		newPresigner: func(destination string) (storage.Presigner, error) {
+			return storage.NewPresigner(appConfig, destination)
+		},
+		findKey:   configKeyFinder(appConfig),
+		clipboard: clipboard.New(),
+		out:       os.Stdout,
+	}
+	if appConfig.History.Enabled {
+		if l.history, err = history.New(appConfig.History.Path); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return l.link(ctx, opts)
+}
+
+func parseLinkArgs(args []string) (linkOptions, error) {
+	var opts linkOptions
+	f := flag.NewFlagSet("link", flag.ContinueOnError)
+	f.BoolVar(&opts.last, "last", false, "link the newest upload from history")
+	f.StringVar(&opts.destination, "destination", "", "link the copy in the destination with the name")
+	f.DurationVar(&opts.duration, "duration", 0, "how long the link is valid, s3.duration by default")
+	if err := f.Parse(args); err != nil {
+		return opts, err
+	}
+
+	switch {
+	case f.NArg() > 1:
+		return opts, errors.New("only one screenshot can be linked at a time")
+	case f.NArg() == 1 && opts.last:
+		return opts, errors.New("use either --last or a key")
+	case f.NArg() == 1:
+		opts.target = f.Arg(0)
+	case !opts.last:
+		return opts, errNothingToLink
+	}
+	if opts.duration < 0 || opts.duration > maxLinkDuration {
+		return opts, fmt.Errorf("invalid --duration %s, links are valid for at most %s", opts.duration, maxLinkDuration)
+	}
+
+	return opts, nil
+}
+
+// link prints a new link and copies it to the clipboard, the link in history is replaced
+func (l *linker) link(ctx context.Context, opts linkOptions) error {
+	record, found, err := findUpload(l.history, opts.target, opts.last)
+	if err != nil {
+		return err
+	}
+	if found && !record.Removed.IsZero() {
+		return fmt.Errorf("%s was deleted on %s", record.Key, record.Removed.Format(dateLayout))
+	}
+
+	var (
+		location history.Location
+		previous string
+	)
+	if found {
+		location, previous = record.Locations()[0], record.URL
+		if opts.destination != "" && opts.destination != location.Destination {
+			copies := onlyDestination(record.Copies, opts.destination)
+			if len(copies) == 0 {
+				return fmt.Errorf("the screenshot was not uploaded to %s", opts.destination)
+			}
+			// links of copies are not in history
+			location, previous = copies[0], ""
+		}
+	} else {
+		if location, err = targetLocation(l.findKey, opts.destination, opts.target); err != nil {
+			return err
+		}
+		if location.Key != opts.target {
+			// the link still has the key of encrypted screenshots
+			previous = opts.target
+		}
+	}
+
+	p, err := l.newPresigner(location.Destination)
+	if err != nil {
+		return err
+	}
+	renewed, err := p.Presign(ctx, location.Key, previous, opts.duration)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(l.out, renewed.URL)
+	if err := l.clipboard.Copy(renewed.URL); err != nil {
+		log.Printf("Could not copy the url to clipboard, got %v", err)
+	}
+
+	if found && previous != "" {
+		return l.history.SetLink(record.ID, renewed.URL, renewed.Expires)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"foxyshot/history"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLinkArgs(t *testing.T) {
+	opts, err := parseLinkArgs([]string{"--duration", "72h", "--destination", "archive", "shot.jpg"})
+	require.NoError(t, err)
+	assert.Equal(t, linkOptions{target: "shot.jpg", destination: "archive", duration: 72 * time.Hour}, opts)
+
+	_, err = parseLinkArgs(nil)
+	assert.ErrorIs(t, err, errNothingToLink)
+	_, err = parseLinkArgs([]string{"--duration", "200h", "shot.jpg"})
+	assert.EqualError(t, err, "invalid --duration 200h0m0s, links are valid for at most 168h0m0s")
+}
+
+func TestLinker_Link(t *testing.T) {
+	record := history.Record{
+		ID: 3, Key: "shot.jpg", Destination: "team", URL: "https://foxy/shot.jpg?old",
+		Copies: []history.Location{{Destination: "archive", Key: "archive/shot.jpg"}},
+	}
+
+	tests := []struct {
+		name         string
+		opts         linkOptions
+		wantPresign  string
+		wantPrevious string
+		wantHistory  string
+		wantErr      string
+	}{
+		{"by url", linkOptions{target: "https://foxy/shot.jpg?old", duration: time.Hour}, "team:shot.jpg", "https://foxy/shot.jpg?old", "https://new/shot.jpg", ""},
+		{"last", linkOptions{last: true}, "team:shot.jpg", "https://foxy/shot.jpg?old", "https://new/shot.jpg", ""},
+		{"copy", linkOptions{target: "shot.jpg", destination: "archive"}, "archive:archive/shot.jpg", "", record.URL, ""},
+		{"key not in history", linkOptions{target: "other.jpg", destination: "team"}, "team:other.jpg", "", record.URL, ""},
+		{"link not in history", linkOptions{target: "https://cdn/other.jpg#k=secret"}, "team:other.jpg", "https://cdn/other.jpg#k=secret", record.URL, ""},
+		{"unknown copy", linkOptions{target: "shot.jpg", destination: "backup"}, "", "", record.URL, "the screenshot was not uploaded to backup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &historyStub{record: record}
+			p := &presignerMock{}
+			clip := &clipboardMock{}
+			out := &bytes.Buffer{}
+			l := &linker{
+				newPresigner: func(destination string) (storage.Presigner, error) {
+					p.destination = destination
+
+					return p, nil
+				},
+				findKey:   cdnKeyFinder,
+				clipboard: clip,
+				out:       out,
+				history:   h,
+			}
+
+			err := l.link(context.Background(), tt.opts)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPresign, p.destination+":"+p.key)
+			assert.Equal(t, tt.wantPrevious, p.previous)
+			assert.Equal(t, tt.opts.duration, p.duration)
+			assert.Equal(t, "https://new/"+p.key+"\n", out.String())
+			assert.Equal(t, "https://new/"+p.key, clip.copied)
+			assert.Equal(t, tt.wantHistory, h.record.URL)
+		})
+	}
+}
+
+func TestLinker_LinkRemoved(t *testing.T) {
+	h := &historyStub{record: history.Record{ID: 1, Key: "shot.jpg", Removed: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)}}
+	l := &linker{history: h}
+
+	err := l.link(context.Background(), linkOptions{target: "shot.jpg"})
+
+	assert.EqualError(t, err, "shot.jpg was deleted on 2023-05-01")
+}
+
+type presignerMock struct {
+	destination, key, previous string
+	duration                   time.Duration
+}
+
+func (p *presignerMock) Presign(_ context.Context, key, previous string, duration time.Duration) (storage.Result, error) {
+	p.key, p.previous, p.duration = key, previous, duration
+
+	return storage.Result{URL: "https://new/" + key, Key: key}, nil
+}
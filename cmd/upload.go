@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"foxyshot/config"
+	"foxyshot/history"
+	ip "foxyshot/imageprocessing"
+	"foxyshot/storage"
+	"foxyshot/system/clipboard"
+)
+
+var errNoFiles = errors.New("no files to upload, usage: foxyshot upload <file or glob>... or foxyshot upload - to read stdin")
+
+type clipboardCopier interface {
+	Copy(val string) error
+}
+
+type historyRecorder interface {
+	RecordFile(source, processed string, uploaded storage.Result)
+}
+
+// stdinPath is the argument for reading the image from stdin
+const stdinPath = "-"
+
+// fileUploader uploads files given on the command line, the links are printed to out
+type fileUploader struct {
+	pipeline  ip.ScreenshotPipeline
+	uploader  storage.Uploader
+	clipboard clipboardCopier
+	stdin     io.Reader
+	out       io.Writer
+	// history is nil if uploads are not recorded
+	history historyRecorder
+}
+
+func upload(args []string) error {
+	paths, err := expandPaths(args)
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("cannot load config, %w", err)
+	}
+	u, err := newFileUploader(appConfig, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return u.uploadAll(ctx, paths)
+}
+
+func newFileUploader(c *config.Config, stdin io.Reader, out io.Writer) (*fileUploader, error) {
+	uploader, err := storage.New(c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create uploader, %w", err)
+	}
+	// files passed explicitly are never removed
+	pipelineConfig := *c
+	pipelineConfig.Screenshots.RemoveOriginals = false
+
+	u := &fileUploader{
+		pipeline:  ip.NewPipeline(&pipelineConfig),
+		uploader:  uploader,
+		clipboard: clipboard.New(),
+		stdin:     stdin,
+		out:       out,
+	}
+	if c.History.Enabled {
+		recorder, err := history.NewRecorder(c)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open history, %w", err)
+		}
+		u.history = recorder
+	}
+
+	return u, nil
+}
+
+// uploadAll uploads every file even if some of them fail, the last link is copied to the clipboard
+func (u *fileUploader) uploadAll(ctx context.Context, paths []string) error {
+	var last string
+	failed := 0
+	for _, path := range paths {
+		url, err := u.uploadFile(ctx, path)
+		if err != nil {
+			log.Printf("Cannot upload %s, %v \n", path, err)
+			failed++
+
+			continue
+		}
+		_, _ = fmt.Fprintln(u.out, url)
+		last = url
+	}
+
+	if last != "" {
+		if err := u.clipboard.Copy(last); err != nil {
+			log.Printf("Could not copy the url to clipboard, got %v", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, len(paths))
+	}
+
+	return nil
+}
+
+func (u *fileUploader) uploadFile(ctx context.Context, path string) (string, error) {
+	processed, err := u.process(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := os.Remove(processed); err != nil {
+			log.Printf("Failed to remove %s, reason: %v\n", processed, err)
+		}
+	}()
+
+	source := ""
+	if path != stdinPath {
+		source = path
+	}
+	uploaded, err := u.uploader.Upload(ctx, processed, storage.UploadOptions{Source: source})
+	var partial *storage.PartialError
+	if err != nil && !(errors.As(err, &partial) && uploaded.URL != "") {
+		return "", err
+	}
+	if err != nil {
+		log.Printf("Uploaded %s, but %v \n", path, err)
+	}
+	if u.history != nil {
+		u.history.RecordFile(source, processed, uploaded)
+	}
+
+	return uploaded.URL, nil
+}
+
+func (u *fileUploader) process(path string) (string, error) {
+	if path == stdinPath {
+		return u.pipeline.RunReader(u.stdin)
+	}
+
+	return u.pipeline.Run(path)
+}
+
+// expandPaths resolves globs, so they also work when the shell does not expand them
+func expandPaths(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, errNoFiles
+	}
+
+	var paths []string
+	stdin := false
+	for _, arg := range args {
+		if arg == stdinPath {
+			if stdin {
+				return nil, errors.New("stdin can be uploaded only once")
+			}
+			stdin = true
+		}
+		if !strings.ContainsAny(arg, "*?[") {
+			paths = append(paths, arg)
+
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %s, %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
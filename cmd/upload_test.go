@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pipelineMock struct {
+	err   error
+	piped string
+}
+
+func (p *pipelineMock) RunReader(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	p.piped = string(data)
+
+	return p.Run("-")
+}
+
+func (p *pipelineMock) Run(path string) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	f, err := os.CreateTemp("", "foxy_test")
+	if err != nil {
+		return "", err
+	}
+
+	return f.Name(), f.Close()
+}
+
+// uploaderMock fails the upload with the failAt number, starting from 1
+type uploaderMock struct {
+	failAt    int
+	calls     int
+	processed []string
+}
+
+func (u *uploaderMock) Upload(_ context.Context, path string, _ storage.UploadOptions) (storage.Result, error) {
+	u.calls++
+	u.processed = append(u.processed, path)
+	if u.calls == u.failAt {
+		return storage.Result{}, errors.New("upload failed")
+	}
+
+	return storage.Result{URL: fmt.Sprintf("https://foxy/%d", u.calls)}, nil
+}
+
+type clipboardMock struct {
+	copied string
+}
+
+func (c *clipboardMock) Copy(val string) error {
+	c.copied = val
+
+	return nil
+}
+
+func TestFileUploader_UploadAll(t *testing.T) {
+	out := &bytes.Buffer{}
+	uploader := &uploaderMock{}
+	clip := &clipboardMock{}
+	u := &fileUploader{pipeline: &pipelineMock{}, uploader: uploader, clipboard: clip, out: out}
+
+	err := u.uploadAll(context.Background(), []string{"a.png", "b.png"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://foxy/1\nhttps://foxy/2\n", out.String())
+	assert.Equal(t, "https://foxy/2", clip.copied)
+	for _, processed := range uploader.processed {
+		assert.NoFileExists(t, processed)
+	}
+}
+
+type historyMock struct {
+	sources []string
+}
+
+func (h *historyMock) RecordFile(source, processed string, uploaded storage.Result) {
+	h.sources = append(h.sources, source)
+}
+
+func TestFileUploader_RecordsHistory(t *testing.T) {
+	h := &historyMock{}
+	u := &fileUploader{pipeline: &pipelineMock{}, uploader: &uploaderMock{failAt: 2}, clipboard: &clipboardMock{},
+		stdin: strings.NewReader("png bytes"), out: &bytes.Buffer{}, history: h}
+
+	_ = u.uploadAll(context.Background(), []string{"a.png", "b.png", "-"})
+
+	assert.Equal(t, []string{"a.png", ""}, h.sources)
+}
+
+func TestFileUploader_UploadAllFailure(t *testing.T) {
+	out := &bytes.Buffer{}
+	clip := &clipboardMock{}
+	u := &fileUploader{pipeline: &pipelineMock{}, uploader: &uploaderMock{failAt: 2}, clipboard: clip, out: out}
+
+	err := u.uploadAll(context.Background(), []string{"a.png", "b.png"})
+
+	assert.EqualError(t, err, "1 of 2 uploads failed")
+	assert.Equal(t, "https://foxy/1\n", out.String())
+	assert.Equal(t, "https://foxy/1", clip.copied)
+}
+
+func TestFileUploader_PipelineFailure(t *testing.T) {
+	clip := &clipboardMock{}
+	u := &fileUploader{pipeline: &pipelineMock{err: errors.New("png error")}, uploader: &uploaderMock{}, clipboard: clip, out: &bytes.Buffer{}}
+
+	err := u.uploadAll(context.Background(), []string{"a.txt"})
+
+	assert.EqualError(t, err, "1 of 1 uploads failed")
+	assert.Empty(t, clip.copied)
+}
+
+func TestFileUploader_UploadStdin(t *testing.T) {
+	out := &bytes.Buffer{}
+	pipeline := &pipelineMock{}
+	u := &fileUploader{pipeline: pipeline, uploader: &uploaderMock{}, clipboard: &clipboardMock{}, stdin: strings.NewReader("png bytes"), out: out}
+
+	err := u.uploadAll(context.Background(), []string{"-"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "png bytes", pipeline.piped)
+	assert.Equal(t, "https://foxy/1\n", out.String())
+}
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	paths, err := expandPaths([]string{filepath.Join(dir, "*.png"), "missing.png"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png"), "missing.png"}, paths)
+
+	_, err = expandPaths([]string{filepath.Join(dir, "*.gif")})
+	assert.ErrorContains(t, err, "no files match")
+
+	_, err = expandPaths(nil)
+	assert.ErrorIs(t, err, errNoFiles)
+
+	paths, err = expandPaths([]string{"-"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-"}, paths)
+
+	_, err = expandPaths([]string{"-", "-"})
+	assert.EqualError(t, err, "stdin can be uploaded only once")
+}
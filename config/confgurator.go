@@ -9,6 +9,7 @@ import (
 const configTemplate = `
 {
     "watchFolder": "Folder to store screenshots (e. g. ~/Screenshots)",
+    "backend": "s3",
     "s3": {
 		"key":        "S3 access key",
 		"secret":     "S3 secret",
@@ -17,11 +18,49 @@ const configTemplate = `
 		"bucket":     "S3 bucket",
 		"publicURIs": false,
 		"duration":   "if publicURIs is false, this is the duration of the presigned URL. e.g. 24h",
-		"cdn":        "custom domain for sharing screenshots from your S3"
+		"cdn":        "custom domain for sharing screenshots from your S3",
+		"keyTemplate": "{uuid}.{ext}"
+	},
+	"local": {
+		"dir": "if backend is local, folder to copy screenshots to (e. g. ~/Dropbox/Screenshots)",
+		"url": "base URL the folder is served from"
+	},
+	"webdav": {
+		"url":       "if backend is webdav, URL of the folder to upload to",
+		"username":  "WebDAV user",
+		"password":  "WebDAV password or app token",
+		"auth":      "basic or digest",
+		"publicURL": "prefix for share links"
+	},
+	"sftp": {
+		"host":       "if backend is sftp, host:port of the SSH server",
+		"username":   "SSH user",
+		"keyFile":    "path to the private key, ssh-agent is used if empty",
+		"knownHosts": "~/.ssh/known_hosts",
+		"dir":        "remote folder served by your web server",
+		"url":        "base URL the remote folder is served from"
+	},
+	"http": {
+		"url":       "if backend is http, endpoint accepting multipart uploads",
+		"method":    "POST",
+		"fileField": "file",
+		"headers":   [{"name": "Authorization", "value": "token of your share service"}],
+		"fields":    [],
+		"urlPath":   "path to the link in a JSON response, e.g. data.url",
+		"urlRegexp": "or a regular expression matching the link in the response"
 	},
 	"screenshots": {
 		"jpegQuality": 999,
-		"removeOriginals": true 
+		"maxSizeKB": 0,
+		"jpegMinQuality": 10,
+		"jpegMaxQuality": 90,
+		"removeOriginals": true,
+		"format": "jpeg",
+		"webpQuality": 75,
+		"webpLossless": false,
+		"pngColors": 256,
+		"pngDither": false,
+		"minPsnr": 35
 	}
 }`
 
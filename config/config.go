@@ -13,13 +13,37 @@ import (
 // Config Main config for the application
 type Config struct {
 	// Folder where screenshots are stored
-	WatchFor    string `mapstructure:"watchFolder"`
-	S3          S3Config
+	WatchFor string `mapstructure:"watchFolder"`
+	// Single destination configured at the top level, used when Destinations is empty
+	Destination `mapstructure:",squash"`
+	// Screenshots are uploaded to all destinations in parallel
+	Destinations []Destination `mapstructure:"-"`
+	// Try destinations in order until one succeeds instead of uploading to all of them
+	Failover    bool
+	Queue       QueueConfig
+	History     HistoryConfig
 	Screenshots struct {
 		// Compression level for JPEGs
 		JpegQuality int
+		// Largest JPEG in kilobytes, the quality is picked between JpegMinQuality and JpegMaxQuality to fit it
+		// Screenshots that do not fit even with JpegMinQuality are downscaled. 0 always uses JpegQuality.
+		MaxSizeKB      int
+		JpegMinQuality int
+		JpegMaxQuality int
 		// Remove original screenshot files to save space
 		RemoveOriginals bool
+		// Format of uploaded screenshots, jpeg, webp, png or auto to pick the smallest one
+		Format string
+		// Compression level for lossy WebPs, from 1 to 100
+		WebPQuality int
+		// Keep every pixel of WebPs, WebPQuality is ignored then; on by default, lossy WebPs are experimental
+		WebPLossless bool
+		// Palette size of PNGs, from 2 to 256, screenshots with more colors are quantized
+		PngColors int
+		// Dither quantized PNGs to smooth gradients
+		PngDither bool
+		// Lowest PSNR in dB a format needs to be picked in auto mode
+		MinPSNR float64
 	}
 }
 
@@ -35,20 +59,207 @@ type S3Config struct {
 	// Sets an expiration date for presigned url (only used is PublicURIs is set to false in s3 config)
 	Duration time.Duration
 	CDN      string
+	// Presigned links to screenshots matching a rule expire after its duration instead, the first matching rule is used
+	LinkDurations []LinkDuration
+	// Upload attempts before giving up, 1 disables retries
+	MaxAttempts int
+	// Limits a single upload attempt, no limit if zero
+	AttemptTimeout time.Duration
+	// Delay before the first retry, doubled after every attempt with a random jitter added
+	RetryDelay time.Duration
+	// Template for object keys, e.g. {date:2006/01/02}/{origname}-{shortid}.{ext}
+	// Placeholders: {date:<go time layout>}, {uuid}, {shortid}, {hash}, {hostname}, {user}, {origname}, {ext}
+	KeyTemplate string
+	// Secret for {hash}, so keys cannot be guessed from known contents. Secret is used if empty
+	HashKey string
+	// Skip uploading files that are already in the bucket, requires {hash} in KeyTemplate
+	Deduplicate bool
+	// File remembering uploaded keys, saves a HEAD request per upload
+	DedupCache string
+	// Headers of uploaded objects, values support the same placeholders as KeyTemplate
+	// e.g. public, max-age=86400
+	CacheControl string
+	// e.g. inline; filename="{origname}.{ext}"
+	ContentDisposition string
+	// Stored as x-amz-meta-<name> headers, e.g. {"host": "{hostname}", "captured": "{date:2006-01-02T15:04:05Z07:00}"}
+	Metadata map[string]string
+	// Server-side encryption: AES256 (SSE-S3), aws:kms or aws:kms:dsse (SSE-KMS)
+	ServerSideEncryption string
+	// KMS key for SSE-KMS, the default key of the bucket is used if empty
+	SSEKMSKeyId string
+	// Base64-encoded 256-bit key for SSE-C, requires https and private links
+	// Presigned links only work for clients sending the key headers, most providers do not accept the key in the query
+	SSECustomerKey string
+	// e.g. STANDARD_IA or GLACIER_IR, the default class of the bucket is used if empty
+	StorageClass string
+	// Encrypt screenshots before uploading, the key is only in the link, so the provider cannot see them
+	// Links open a viewer page uploaded to the bucket that decrypts the screenshot in the browser
+	Encrypt bool
+	// Key of the viewer page, viewer.html by default
+	ViewerKey string
+	// Screenshots older than Retention are deleted while foxyshot is running, zero keeps them forever
+	// Duration of presigned links is capped by it, links to deleted screenshots are useless
+	Retention time.Duration
+	// Only objects under the prefix are deleted, the literal beginning of KeyTemplate is used if empty
+	RetentionPrefix string
+	// How often old screenshots are looked for
+	SweepInterval time.Duration
 }
 
+// LinkDuration sets the expiration of presigned links by the name or folder of the original screenshot
+type LinkDuration struct {
+	// End of the file name with or without the extension, e.g. -share matches "Screenshot-share.png"
+	Suffix string
+	// Matches screenshots in the folder and its subfolders
+	Folder   string
+	Duration time.Duration
+}
+
+// QueueConfig contains config for retrying failed uploads
+type QueueConfig struct {
+	// Failed uploads are kept in Dir and retried while foxyshot is running
+	Enabled bool
+	Dir     string
+	// Delay before the first retry, doubled after every failed attempt up to MaxDelay
+	RetryDelay time.Duration
+	MaxDelay   time.Duration
+}
+
+// HistoryConfig contains config for the list of uploads shown by foxyshot history
+type HistoryConfig struct {
+	Enabled bool
+	// Database file
+	Path string
+}
+
+// LocalConfig contains config for storing screenshots in a local folder
+// Useful with folders synced by Dropbox, NAS mounts or served by a web server
+type LocalConfig struct {
+	// Folder where screenshots are copied
+	Dir string
+	// Base URL the folder is served from, file:// links are returned if empty
+	URL string
+}
+
+// WebDAVConfig contains config for WebDAV servers, e.g. Nextcloud or ownCloud
+type WebDAVConfig struct {
+	// URL of the folder to upload to, missing folders are created
+	URL      string
+	Username string
+	Password string
+	// Authentication scheme: basic (default) or digest
+	Auth string
+	// Prefix for share links, URL is used if empty
+	PublicURL string
+}
+
+// SFTPConfig contains config for uploading over SSH to a folder served by a web server
+type SFTPConfig struct {
+	// host:port of the SSH server, port 22 is used if omitted
+	Host     string
+	Username string
+	// Private key for authentication, ssh-agent is used if empty
+	KeyFile    string
+	Passphrase string
+	// Server keys are verified against this file, ~/.ssh/known_hosts by default
+	KnownHosts string
+	// Remote folder to upload to, created if missing
+	Dir string
+	// Base URL the remote folder is served from
+	URL string
+}
+
+// HTTPConfig contains config for custom share services accepting multipart uploads (xbackbone, zipline etc.)
+type HTTPConfig struct {
+	URL string
+	// POST by default
+	Method string
+	// Name of the form field containing the file
+	FileField string
+	// Sent with every request, e.g. authorization tokens
+	Headers []HTTPParam
+	// Extra form fields
+	Fields []HTTPParam
+	// Path to the link in a JSON response, e.g. data.url or files[0].url
+	URLPath string
+	// Regular expression matching the link in the response, the first group is used if there is one
+	// The whole response body is used as a link if neither URLPath nor URLRegexp is set
+	URLRegexp string
+}
+
+// HTTPParam is a name-value pair used for headers and form fields
+type HTTPParam struct {
+	Name  string
+	Value string
+}
+
+// Supported storage backends
+const (
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendWebDAV = "webdav"
+	BackendSFTP   = "sftp"
+	BackendHTTP   = "http"
+)
+
+// Supported S3 server-side encryption modes
+const (
+	SSEAES256  = "AES256"
+	SSEKMS     = "aws:kms"
+	SSEKMSDSSE = "aws:kms:dsse"
+)
+
+// Supported formats of uploaded screenshots
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+	FormatPNG  = "png"
+	FormatAuto = "auto"
+)
+
+// Supported WebDAV authentication schemes
+const (
+	AuthBasic  = "basic"
+	AuthDigest = "digest"
+)
+
 const (
 	defaultJpegQuality = 30
+	defaultJpegMin     = 10
+	defaultJpegMax     = 90
+	defaultWebPQuality = 75
+	defaultPngColors   = 256
+	defaultMinPSNR     = 35
 	defaultBucket      = "foxy"
 	defaultDuration    = 24 * time.Hour
+	defaultRetryDelay  = 30 * time.Second
+	defaultMaxDelay    = time.Hour
+
+	defaultS3MaxAttempts    = 3
+	defaultS3AttemptTimeout = time.Minute
+	defaultS3RetryDelay     = time.Second
+	defaultSweepInterval    = time.Hour
+	// same as keytemplate.Default, config does not depend on storage
+	defaultKeyTemplate = "{uuid}.{ext}"
 )
 
 func setupViper(v *viper.Viper) {
 	v.SetDefault("screenshots.jpegQuality", defaultJpegQuality)
+	v.SetDefault("screenshots.jpegMinQuality", defaultJpegMin)
+	v.SetDefault("screenshots.jpegMaxQuality", defaultJpegMax)
 	v.SetDefault("screenshots.removeOriginals", true)
-	v.SetDefault("s3.publicURIs", true)
-	v.SetDefault("s3.bucket", defaultBucket)
-	v.SetDefault("s3.duration", defaultDuration)
+	v.SetDefault("screenshots.format", FormatJPEG)
+	v.SetDefault("screenshots.webpQuality", defaultWebPQuality)
+	v.SetDefault("screenshots.webpLossless", true)
+	v.SetDefault("screenshots.pngColors", defaultPngColors)
+	v.SetDefault("screenshots.minPsnr", defaultMinPSNR)
+	v.SetDefault("queue.enabled", true)
+	v.SetDefault("queue.dir", "~/.local/share/foxyshot/queue")
+	v.SetDefault("queue.retryDelay", defaultRetryDelay)
+	v.SetDefault("queue.maxDelay", defaultMaxDelay)
+	v.SetDefault("history.enabled", true)
+	v.SetDefault("history.path", "~/.local/share/foxyshot/history.db")
+	setDestinationDefaults(v)
 
 	v.SetConfigName("config")
 	v.AddConfigPath("$HOME/.config/foxyshot")
@@ -68,13 +279,113 @@ func parseConfigToStruct(v *viper.Viper) (*Config, error) {
 		return nil, fmt.Errorf("parsing config, %w", err)
 	}
 	config.WatchFor = expandHomeFolder(config.WatchFor)
+	config.Queue.Dir = expandHomeFolder(config.Queue.Dir)
+	config.History.Path = expandHomeFolder(config.History.Path)
+
+	if err := config.validateScreenshots(); err != nil {
+		return nil, fmt.Errorf("parsing config, %w", err)
+	}
+	if err := config.Queue.validate(); err != nil {
+		return nil, fmt.Errorf("parsing config, %w", err)
+	}
+
+	config.Destinations, err = parseDestinations(v)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config, %w", err)
+	}
+	if err := config.Destination.normalize(); err != nil {
+		return nil, fmt.Errorf("parsing config, %w", err)
+	}
 
 	log.Printf("Loaded config from %s \n", v.ConfigFileUsed())
-	log.Printf("Watching folder %s. Screenshots will be uploaded to %s \n", config.WatchFor, config.S3.Endpoint)
+	log.Printf("Watching folder %s. Screenshots will be uploaded to %s \n", config.WatchFor, config.describeDestinations())
 
 	return &config, nil
 }
 
+func (c *Config) validateScreenshots() error {
+	if err := c.validateMaxSize(); err != nil {
+		return err
+	}
+
+	switch c.Screenshots.Format {
+	case "", FormatJPEG:
+		return nil
+	case FormatWebP:
+		return c.validateWebP()
+	case FormatPNG:
+		return c.validatePng()
+	case FormatAuto:
+		if c.Screenshots.MinPSNR <= 0 {
+			return fmt.Errorf("invalid screenshots minPsnr %v, use a positive number", c.Screenshots.MinPSNR)
+		}
+		if err := c.validateWebP(); err != nil {
+			return err
+		}
+
+		return c.validatePng()
+	default:
+		return fmt.Errorf("unknown screenshots format %s, use %s, %s, %s or %s", c.Screenshots.Format, FormatJPEG, FormatWebP, FormatPNG, FormatAuto)
+	}
+}
+
+func (q *QueueConfig) validate() error {
+	switch {
+	case !q.Enabled:
+		return nil
+	case q.RetryDelay <= 0:
+		return fmt.Errorf("invalid queue retryDelay %s, use a positive duration", q.RetryDelay)
+	case q.MaxDelay < q.RetryDelay:
+		return fmt.Errorf("invalid queue maxDelay %s, it must not be less than retryDelay %s", q.MaxDelay, q.RetryDelay)
+	default:
+		return nil
+	}
+}
+
+func (c *Config) validateMaxSize() error {
+	s := c.Screenshots
+	switch {
+	case s.MaxSizeKB < 0:
+		return fmt.Errorf("invalid screenshots maxSizeKB %d, use 0 to turn it off", s.MaxSizeKB)
+	case s.MaxSizeKB == 0:
+		return nil
+	case s.JpegMinQuality < 1 || s.JpegMaxQuality > 100 || s.JpegMinQuality > s.JpegMaxQuality:
+		return fmt.Errorf("invalid screenshots jpegMinQuality %d and jpegMaxQuality %d, use 1-100", s.JpegMinQuality, s.JpegMaxQuality)
+	default:
+		return nil
+	}
+}
+
+func (c *Config) validateWebP() error {
+	if !c.Screenshots.WebPLossless && (c.Screenshots.WebPQuality < 1 || c.Screenshots.WebPQuality > 100) {
+		return fmt.Errorf("invalid screenshots webpQuality %d, use 1-100", c.Screenshots.WebPQuality)
+	}
+
+	return nil
+}
+
+func (c *Config) validatePng() error {
+	if c.Screenshots.PngColors < 2 || c.Screenshots.PngColors > 256 {
+		return fmt.Errorf("invalid screenshots pngColors %d, use 2-256", c.Screenshots.PngColors)
+	}
+
+	return nil
+}
+
+// describeDestinations lists where the screenshots go, used for logging
+func (c *Config) describeDestinations() string {
+	if len(c.Destinations) == 0 {
+		return c.Destination.target()
+	}
+
+	targets := make([]string, 0, len(c.Destinations))
+	for _, d := range c.Destinations {
+		targets = append(targets, d.target())
+	}
+
+	return strings.Join(targets, ", ")
+}
+
 func expandHomeFolder(orig string) string {
 	if strings.Contains(orig, "~") {
 		home, err := os.UserHomeDir()
@@ -15,6 +15,26 @@ func TestDefaultSettings(t *testing.T) {
 
 	assert.Equal(t, defaultJpegQuality, v.GetInt("screenshots.jpegQuality"))
 	assert.Equal(t, true, v.GetBool("screenshots.removeOriginals"))
+	assert.Equal(t, FormatJPEG, v.GetString("screenshots.format"))
+	assert.Equal(t, defaultWebPQuality, v.GetInt("screenshots.webpQuality"))
+	assert.True(t, v.GetBool("screenshots.webpLossless"))
+	assert.Equal(t, defaultPngColors, v.GetInt("screenshots.pngColors"))
+	assert.Equal(t, defaultJpegMin, v.GetInt("screenshots.jpegMinQuality"))
+	assert.Equal(t, defaultJpegMax, v.GetInt("screenshots.jpegMaxQuality"))
+	assert.Equal(t, float64(defaultMinPSNR), v.GetFloat64("screenshots.minPsnr"))
+	assert.Equal(t, true, v.GetBool("queue.enabled"))
+	assert.Equal(t, defaultRetryDelay, v.GetDuration("queue.retryDelay"))
+	assert.Equal(t, defaultMaxDelay, v.GetDuration("queue.maxDelay"))
+	assert.Equal(t, BackendS3, v.GetString("backend"))
+	assert.Equal(t, defaultS3MaxAttempts, v.GetInt("s3.maxAttempts"))
+	assert.Equal(t, defaultS3AttemptTimeout, v.GetDuration("s3.attemptTimeout"))
+	assert.Equal(t, defaultS3RetryDelay, v.GetDuration("s3.retryDelay"))
+	assert.Equal(t, "{uuid}.{ext}", v.GetString("s3.keyTemplate"))
+	assert.Equal(t, "~/.cache/foxyshot/uploaded", v.GetString("s3.dedupCache"))
+	assert.Equal(t, time.Hour, v.GetDuration("s3.sweepInterval"))
+	assert.True(t, v.GetBool("history.enabled"))
+	assert.Equal(t, "~/.local/share/foxyshot/history.db", v.GetString("history.path"))
+	assert.Equal(t, AuthBasic, v.GetString("webdav.auth"))
 }
 
 func TestValidConfig(t *testing.T) {
@@ -35,6 +55,9 @@ func TestValidConfig(t *testing.T) {
 	assert.Equal(t, "expected_cdn", c.S3.CDN)
 	assert.Equal(t, false, c.S3.PublicURIs)
 	assert.Equal(t, time.Hour, c.S3.Duration)
+	assert.Equal(t, 5, c.S3.MaxAttempts)
+	assert.Equal(t, 10*time.Second, c.S3.AttemptTimeout)
+	assert.Equal(t, 2*time.Second, c.S3.RetryDelay)
 }
 
 func TestExpandHomeFolder(t *testing.T) {
@@ -46,3 +69,296 @@ func TestExpandHomeFolder(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, home+"/watchfolder", c.WatchFor)
 }
+
+func TestLocalConfig(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	v := viper.New()
+	v.SetConfigFile("./testdata/local.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, BackendLocal, c.Backend)
+	assert.Equal(t, home+"/synced", c.Local.Dir)
+	assert.Equal(t, "https://example.com/screenshots", c.Local.URL)
+}
+
+func TestUnknownBackend(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/unknownbackend.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.EqualError(t, err, `parsing config, unknown storage backend "floppy"`)
+}
+
+func TestWebDAVConfig(t *testing.T) {
+	v := viper.New()
+	setupViper(v)
+	v.SetConfigFile("./testdata/webdav.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, BackendWebDAV, c.Backend)
+	assert.Equal(t, "https://cloud.example.com/remote.php/dav/files/foxy/Screenshots", c.WebDAV.URL)
+	assert.Equal(t, "expected_user", c.WebDAV.Username)
+	assert.Equal(t, "expected_password", c.WebDAV.Password)
+	assert.Equal(t, AuthDigest, c.WebDAV.Auth)
+	assert.Equal(t, "https://cloud.example.com/s/abc/download?path=/&files=", c.WebDAV.PublicURL)
+}
+
+func TestSFTPConfig(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	v := viper.New()
+	setupViper(v)
+	v.SetConfigFile("./testdata/sftp.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, BackendSFTP, c.Backend)
+	assert.Equal(t, "files.example.com:2222", c.SFTP.Host)
+	assert.Equal(t, "expected_user", c.SFTP.Username)
+	assert.Equal(t, home+"/.ssh/id_ed25519", c.SFTP.KeyFile)
+	assert.Equal(t, home+"/.ssh/known_hosts", c.SFTP.KnownHosts)
+	assert.Equal(t, "/var/www/shots", c.SFTP.Dir)
+	assert.Equal(t, "https://files.example.com/shots", c.SFTP.URL)
+}
+
+func TestHTTPConfig(t *testing.T) {
+	v := viper.New()
+	setupViper(v)
+	v.SetConfigFile("./testdata/http.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, BackendHTTP, c.Backend)
+	assert.Equal(t, "https://share.example.com/upload", c.HTTP.URL)
+	assert.Equal(t, "POST", c.HTTP.Method)
+	assert.Equal(t, "file", c.HTTP.FileField)
+	assert.Equal(t, []HTTPParam{{Name: "Authorization", Value: "Bearer expected_token"}}, c.HTTP.Headers)
+	assert.Equal(t, []HTTPParam{{Name: "expectedField", Value: "expected_value"}}, c.HTTP.Fields)
+	assert.Equal(t, "data.url", c.HTTP.URLPath)
+}
+
+func TestHTTPConfig_InvalidRegexp(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/invalidregexp.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "parsing config, invalid http urlRegexp")
+}
+
+func TestDestinations(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	v := viper.New()
+	setupViper(v)
+	v.SetConfigFile("./testdata/destinations.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Len(t, c.Destinations, 2)
+
+	team := c.Destinations[0]
+	assert.Equal(t, "team", team.Name)
+	assert.Equal(t, BackendS3, team.Backend)
+	assert.False(t, team.Primary)
+	assert.Equal(t, "expected_key", team.S3.Key)
+	assert.Equal(t, "expected_endpoint", team.S3.Endpoint)
+	assert.Equal(t, defaultBucket, team.S3.Bucket)
+	assert.Equal(t, defaultDuration, team.S3.Duration)
+	assert.True(t, team.S3.PublicURIs)
+
+	archive := c.Destinations[1]
+	assert.Equal(t, BackendLocal, archive.Name)
+	assert.True(t, archive.Primary)
+	assert.Equal(t, home+"/archive", archive.Local.Dir)
+}
+
+func TestDestinations_Invalid(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/invaliddestination.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.EqualError(t, err, `parsing config, destination 2, unknown webdav auth "ntlm"`)
+}
+
+func TestDestinations_TwoPrimaries(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/twoprimaries.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.EqualError(t, err, "parsing config, destinations 1 and 2 are both primary, only one link can be copied")
+}
+
+func TestFailover(t *testing.T) {
+	v := viper.New()
+	setupViper(v)
+	v.SetConfigFile("./testdata/failover.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.True(t, c.Failover)
+	assert.Equal(t, 10*time.Second, c.Destinations[0].Timeout)
+	assert.Equal(t, time.Duration(0), c.Destinations[1].Timeout)
+}
+
+func TestHeaders(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/headers.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "public, max-age=86400", c.S3.CacheControl)
+	assert.Equal(t, `inline; filename="{origname}.{ext}"`, c.S3.ContentDisposition)
+	assert.Equal(t, map[string]string{"host": "{hostname}"}, c.S3.Metadata)
+}
+
+func TestEncryption(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/encryption.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, SSEKMS, c.S3.ServerSideEncryption)
+	assert.Equal(t, "alias/foxyshot", c.S3.SSEKMSKeyId)
+	assert.Equal(t, "STANDARD_IA", c.S3.StorageClass)
+}
+
+func TestSSECustomerKeyRequiresPrivateLinks(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/invalidencryption.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.EqualError(t, err, "parsing config, s3 sseCustomerKey requires publicURIs false and no cdn, objects cannot be read without the key")
+}
+
+func TestEncryptCannotDeduplicate(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/invalidencrypt.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.EqualError(t, err, "parsing config, s3 encrypt cannot be used with deduplicate, every upload has a new key")
+}
+
+func TestRetentionCapsDuration(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/retention.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, c.S3.Retention)
+	assert.Equal(t, 24*time.Hour, c.S3.Duration)
+	assert.Equal(t, 10*time.Minute, c.S3.SweepInterval)
+}
+
+func TestLinkDurations(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/linkdurations.json")
+	c, err := parseConfigToStruct(v)
+
+	home, _ := os.UserHomeDir()
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkDuration{
+		{Suffix: "-share", Duration: 168 * time.Hour},
+		{Folder: home + "/Desktop/Screenshots/quick", Duration: time.Hour},
+	}, c.S3.LinkDurations)
+}
+
+func TestInvalidLinkDurations(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/invalidlinkdurations.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.Nil(t, c)
+	assert.EqualError(t, err, "parsing config, s3 linkDurations[0] needs a suffix or a folder")
+}
+
+func TestInvalidQueueDelays(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr string
+	}{
+		{"invalidretrydelay.json", "parsing config, invalid queue retryDelay 0s, use a positive duration"},
+		{"invalidmaxdelay.json", "parsing config, invalid queue maxDelay 10s, it must not be less than retryDelay 1m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			v := viper.New()
+			setupViper(v)
+			v.SetConfigFile("./testdata/" + tt.file)
+			c, err := parseConfigToStruct(v)
+
+			assert.Nil(t, c)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestWebPScreenshots(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/webp.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, FormatWebP, c.Screenshots.Format)
+	assert.Equal(t, 60, c.Screenshots.WebPQuality)
+	assert.True(t, c.Screenshots.WebPLossless)
+}
+
+func TestPngScreenshots(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/png.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, FormatPNG, c.Screenshots.Format)
+	assert.Equal(t, 64, c.Screenshots.PngColors)
+	assert.True(t, c.Screenshots.PngDither)
+}
+
+func TestAutoScreenshots(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/auto.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, FormatAuto, c.Screenshots.Format)
+	assert.Equal(t, 38.5, c.Screenshots.MinPSNR)
+}
+
+func TestMaxSizeScreenshots(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("./testdata/maxsize.json")
+	c, err := parseConfigToStruct(v)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 300, c.Screenshots.MaxSizeKB)
+	assert.Equal(t, 20, c.Screenshots.JpegMinQuality)
+	assert.Equal(t, 85, c.Screenshots.JpegMaxQuality)
+}
+
+func TestInvalidScreenshots(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr string
+	}{
+		{"./testdata/invalidformat.json", "parsing config, unknown screenshots format heic, use jpeg, webp, png or auto"},
+		{"./testdata/invalidwebpquality.json", "parsing config, invalid screenshots webpQuality 0, use 1-100"},
+		{"./testdata/invalidpngcolors.json", "parsing config, invalid screenshots pngColors 300, use 2-256"},
+		{"./testdata/invalidminpsnr.json", "parsing config, invalid screenshots minPsnr 0, use a positive number"},
+		{"./testdata/invalidauto.json", "parsing config, invalid screenshots pngColors 1, use 2-256"},
+		{"./testdata/invalidmaxsize.json", "parsing config, invalid screenshots jpegMinQuality 80 and jpegMaxQuality 50, use 1-100"},
+	}
+	for _, tt := range tests {
+		v := viper.New()
+		v.SetConfigFile(tt.file)
+		c, err := parseConfigToStruct(v)
+
+		assert.Nil(t, c)
+		assert.EqualError(t, err, tt.wantErr)
+	}
+}
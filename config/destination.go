@@ -0,0 +1,258 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Destination is a storage backend with its settings
+type Destination struct {
+	// Storage backend for uploads: s3 (default), local, webdav, sftp or http
+	Backend string
+	// Used in logs and notifications, defaults to the backend
+	Name string
+	// Link from the primary destination is copied to the clipboard, the first destination is primary by default
+	Primary bool
+	// Limits a single upload attempt, no limit if zero
+	Timeout time.Duration
+	S3      S3Config
+	Local   LocalConfig
+	WebDAV  WebDAVConfig
+	SFTP    SFTPConfig
+	HTTP    HTTPConfig
+}
+
+func setDestinationDefaults(v *viper.Viper) {
+	v.SetDefault("backend", BackendS3)
+	v.SetDefault("s3.publicURIs", true)
+	v.SetDefault("s3.bucket", defaultBucket)
+	v.SetDefault("s3.duration", defaultDuration)
+	v.SetDefault("s3.maxAttempts", defaultS3MaxAttempts)
+	v.SetDefault("s3.attemptTimeout", defaultS3AttemptTimeout)
+	v.SetDefault("s3.retryDelay", defaultS3RetryDelay)
+	v.SetDefault("s3.keyTemplate", defaultKeyTemplate)
+	v.SetDefault("s3.dedupCache", "~/.cache/foxyshot/uploaded")
+	v.SetDefault("s3.sweepInterval", defaultSweepInterval)
+	v.SetDefault("webdav.auth", AuthBasic)
+	v.SetDefault("sftp.knownHosts", "~/.ssh/known_hosts")
+	v.SetDefault("http.method", http.MethodPost)
+	v.SetDefault("http.fileField", "file")
+}
+
+// parseDestinations reads the destinations list, each entry gets the same defaults as the top-level destination
+func parseDestinations(v *viper.Viper) ([]Destination, error) {
+	raw, ok := v.Get("destinations").([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	destinations := make([]Destination, 0, len(raw))
+	primary := 0
+	for i, r := range raw {
+		entry, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("destination %d is not an object", i+1)
+		}
+
+		sub := viper.New()
+		setDestinationDefaults(sub)
+		if err := sub.MergeConfigMap(entry); err != nil {
+			return nil, fmt.Errorf("destination %d, %w", i+1, err)
+		}
+		var d Destination
+		if err := sub.Unmarshal(&d); err != nil {
+			return nil, fmt.Errorf("destination %d, %w", i+1, err)
+		}
+		if err := d.normalize(); err != nil {
+			return nil, fmt.Errorf("destination %d, %w", i+1, err)
+		}
+		if d.Primary && primary != 0 {
+			return nil, fmt.Errorf("destinations %d and %d are both primary, only one link can be copied", primary, i+1)
+		}
+		if d.Primary {
+			primary = i + 1
+		}
+		destinations = append(destinations, d)
+	}
+
+	return destinations, nil
+}
+
+// normalize expands paths and validates the settings
+func (d *Destination) normalize() error {
+	d.Local.Dir = expandHomeFolder(d.Local.Dir)
+	d.S3.DedupCache = expandHomeFolder(d.S3.DedupCache)
+	d.SFTP.KeyFile = expandHomeFolder(d.SFTP.KeyFile)
+	d.SFTP.KnownHosts = expandHomeFolder(d.SFTP.KnownHosts)
+	for i := range d.S3.LinkDurations {
+		d.S3.LinkDurations[i].Folder = expandHomeFolder(d.S3.LinkDurations[i].Folder)
+	}
+	if d.Name == "" {
+		d.Name = d.Backend
+	}
+
+	if err := validateBackend(d.Backend); err != nil {
+		return err
+	}
+	if err := validateWebDAVAuth(d.WebDAV.Auth); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(d.HTTP.URLRegexp); err != nil {
+		return fmt.Errorf("invalid http urlRegexp, %w", err)
+	}
+	if err := validateHeaders(&d.S3); err != nil {
+		return err
+	}
+	if err := validateEncryption(&d.S3); err != nil {
+		return err
+	}
+	if err := validateLinkDurations(d.S3.LinkDurations); err != nil {
+		return err
+	}
+	if err := alignRetention(&d.S3); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateLinkDurations(rules []LinkDuration) error {
+	for i, r := range rules {
+		if r.Suffix == "" && r.Folder == "" {
+			return fmt.Errorf("s3 linkDurations[%d] needs a suffix or a folder", i)
+		}
+		if r.Duration <= 0 {
+			return fmt.Errorf("invalid s3 linkDurations[%d] duration %s", i, r.Duration)
+		}
+	}
+
+	return nil
+}
+
+// sseCustomerKeyLength is the size of AES-256 keys S3 accepts for SSE-C
+const sseCustomerKeyLength = 32
+
+var metadataName = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+func validateHeaders(c *S3Config) error {
+	if err := validateHeaderValue("cacheControl", c.CacheControl); err != nil {
+		return err
+	}
+	if err := validateHeaderValue("contentDisposition", c.ContentDisposition); err != nil {
+		return err
+	}
+	for name, value := range c.Metadata {
+		if !metadataName.MatchString(name) {
+			return fmt.Errorf("invalid s3 metadata name %q, only letters, digits, - and _ are allowed", name)
+		}
+		if err := validateHeaderValue("metadata "+name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateEncryption(c *S3Config) error {
+	switch c.ServerSideEncryption {
+	case "", SSEAES256, SSEKMS, SSEKMSDSSE:
+	default:
+		return fmt.Errorf("unknown s3 serverSideEncryption %q, use %s, %s or %s", c.ServerSideEncryption, SSEAES256, SSEKMS, SSEKMSDSSE)
+	}
+	if c.SSEKMSKeyId != "" && c.ServerSideEncryption != SSEKMS && c.ServerSideEncryption != SSEKMSDSSE {
+		return fmt.Errorf("s3 sseKmsKeyId requires serverSideEncryption %s", SSEKMS)
+	}
+
+	if c.Encrypt && c.Deduplicate {
+		return errors.New("s3 encrypt cannot be used with deduplicate, every upload has a new key")
+	}
+	if c.SSECustomerKey == "" {
+		return nil
+	}
+	if c.Encrypt {
+		return errors.New("s3 encrypt cannot be used with sseCustomerKey, browsers cannot send the key")
+	}
+	if c.ServerSideEncryption != "" {
+		return errors.New("s3 sseCustomerKey cannot be used with serverSideEncryption")
+	}
+	key, err := base64.StdEncoding.DecodeString(c.SSECustomerKey)
+	if err != nil || len(key) != sseCustomerKeyLength {
+		return fmt.Errorf("s3 sseCustomerKey must be a base64-encoded %d-byte key", sseCustomerKeyLength)
+	}
+	if c.PublicURIs || c.CDN != "" {
+		return errors.New("s3 sseCustomerKey requires publicURIs false and no cdn, objects cannot be read without the key")
+	}
+
+	return nil
+}
+
+func alignRetention(c *S3Config) error {
+	if c.Retention < 0 {
+		return fmt.Errorf("invalid s3 retention %s", c.Retention)
+	}
+	if c.Retention == 0 {
+		return nil
+	}
+	if c.SweepInterval <= 0 {
+		return fmt.Errorf("invalid s3 sweepInterval %s", c.SweepInterval)
+	}
+	if c.Duration > c.Retention {
+		log.Printf("Presigned links will expire after %s together with screenshots instead of %s \n", c.Retention, c.Duration)
+		c.Duration = c.Retention
+	}
+	for i := range c.LinkDurations {
+		c.LinkDurations[i].Duration = min(c.LinkDurations[i].Duration, c.Retention)
+	}
+
+	return nil
+}
+
+func validateHeaderValue(name, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("invalid s3 %s, line breaks are not allowed", name)
+	}
+
+	return nil
+}
+
+func validateBackend(backend string) error {
+	switch backend {
+	case "", BackendS3, BackendLocal, BackendWebDAV, BackendSFTP, BackendHTTP:
+		return nil
+	default:
+		return fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+func validateWebDAVAuth(auth string) error {
+	switch auth {
+	case "", AuthBasic, AuthDigest:
+		return nil
+	default:
+		return fmt.Errorf("unknown webdav auth %q", auth)
+	}
+}
+
+// target describes where the screenshots go, used for logging
+func (d *Destination) target() string {
+	switch d.Backend {
+	case BackendLocal:
+		return d.Local.Dir
+	case BackendWebDAV:
+		return d.WebDAV.URL
+	case BackendSFTP:
+		return d.SFTP.Host
+	case BackendHTTP:
+		return d.HTTP.URL
+	default:
+		return d.S3.Endpoint
+	}
+}
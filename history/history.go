@@ -0,0 +1,312 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout is how long to wait for another foxyshot process holding the database
+const openTimeout = 5 * time.Second
+
+var uploadsBucket = []byte("uploads")
+
+// Record is an uploaded screenshot
+type Record struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	// Original screenshot, empty for images piped to stdin
+	Source string `json:"source"`
+	// Identifies the file in the destination, e.g. S3 object key
+	Key         string `json:"key"`
+	Destination string `json:"destination"`
+	URL         string `json:"url"`
+	// Size of the uploaded file in bytes
+	Size int64 `json:"size"`
+	// Zero if the link does not expire
+	Expires time.Time `json:"expires"`
+	// Uploads of the same screenshot to other destinations
+	Copies []Location `json:"copies,omitempty"`
+	// When the screenshot was deleted, zero if it was not
+	Removed time.Time `json:"removed"`
+}
+
+// Location is a file in a destination
+type Location struct {
+	Destination string `json:"destination"`
+	Key         string `json:"key"`
+}
+
+// Locations lists every destination that stored the screenshot
+func (r Record) Locations() []Location {
+	return append([]Location{{Destination: r.Destination, Key: r.Key}}, r.Copies...)
+}
+
+// Filter selects records, zero values match everything
+type Filter struct {
+	Since time.Time
+	// Case-insensitive substring of the source, key, destination or url
+	Grep string
+}
+
+// History stores uploads in a bbolt database
+// The database is opened for every operation, so the daemon and commands can use it at the same time
+type History struct {
+	path string
+}
+
+// New creates the folder for the database if it does not exist
+func New(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("history error, %w", err)
+	}
+
+	return &History{path: path}, nil
+}
+
+// Add stores the record, ID is assigned in the order of uploads
+func (h *History) Add(r Record) error {
+	return h.update(func(b *bolt.Bucket) error {
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(itob(id), data)
+	})
+}
+
+// List returns matching records, oldest first
+func (h *History) List(f Filter) ([]Record, error) {
+	var records []Record
+	err := h.view(func(b *bolt.Bucket) error {
+		return b.ForEach(func(_, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if f.matches(r) {
+				records = append(records, r)
+			}
+
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+// Last returns the newest record that is not removed, false if there is none
+func (h *History) Last() (Record, bool, error) {
+	var last Record
+	found := false
+	err := h.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if err := json.Unmarshal(v, &last); err != nil {
+				return err
+			}
+			if last.Removed.IsZero() {
+				found = true
+
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return last, found && err == nil, err
+}
+
+// Find returns the newest record with the key or url, false if there is none
+func (h *History) Find(keyOrURL string) (Record, bool, error) {
+	var found Record
+	ok := false
+	err := h.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if r.URL == keyOrURL || r.hasKey(keyOrURL) {
+				found, ok = r, true
+
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return found, ok && err == nil, err
+}
+
+func (r Record) hasKey(key string) bool {
+	for _, l := range r.Locations() {
+		if l.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MarkRemoved sets Removed of the record
+func (h *History) MarkRemoved(id uint64, removed time.Time) error {
+	return h.change(id, func(r *Record) {
+		r.Removed = removed
+	})
+}
+
+// MarkKeysRemoved sets Removed of every record that stored one of the keys, uploads share keys if they are deduplicated
+func (h *History) MarkKeysRemoved(keys []string, removed time.Time) (int, error) {
+	marked := 0
+	err := h.update(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if !r.Removed.IsZero() || !r.hasAnyKey(keys) {
+				continue
+			}
+			r.Removed = removed
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(k, data); err != nil {
+				return err
+			}
+			marked++
+		}
+
+		return nil
+	})
+
+	return marked, err
+}
+
+func (r Record) hasAnyKey(keys []string) bool {
+	for _, key := range keys {
+		if r.hasKey(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetLink replaces the link of the record with a regenerated one
+func (h *History) SetLink(id uint64, url string, expires time.Time) error {
+	return h.change(id, func(r *Record) {
+		r.URL, r.Expires = url, expires
+	})
+}
+
+func (h *History) change(id uint64, fn func(r *Record)) error {
+	return h.update(func(b *bolt.Bucket) error {
+		data := b.Get(itob(id))
+		if data == nil {
+			return fmt.Errorf("no record %d", id)
+		}
+		var r Record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		fn(&r)
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(itob(id), data)
+	})
+}
+
+func (f Filter) matches(r Record) bool {
+	if r.Time.Before(f.Since) {
+		return false
+	}
+	if f.Grep == "" {
+		return true
+	}
+
+	grep := strings.ToLower(f.Grep)
+	for _, field := range []string{r.Source, r.Key, r.Destination, r.URL} {
+		if strings.Contains(strings.ToLower(field), grep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *History) update(fn func(b *bolt.Bucket) error) error {
+	db, err := bolt.Open(h.path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return fmt.Errorf("history error, %w", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(uploadsBucket)
+		if err != nil {
+			return err
+		}
+
+		return fn(b)
+	})
+	if err != nil {
+		return fmt.Errorf("history error, %w", err)
+	}
+
+	return nil
+}
+
+func (h *History) view(fn func(b *bolt.Bucket) error) error {
+	if _, err := os.Stat(h.path); os.IsNotExist(err) {
+		return nil
+	}
+	db, err := bolt.Open(h.path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("history error, %w", err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(uploadsBucket)
+		if b == nil {
+			return nil
+		}
+
+		return fn(b)
+	})
+	if err != nil {
+		return fmt.Errorf("history error, %w", err)
+	}
+
+	return nil
+}
+
+// itob keeps keys sorted by ID
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+
+	return b
+}
@@ -0,0 +1,128 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_AddAndList(t *testing.T) {
+	h, err := New(filepath.Join(t.TempDir(), "data", "history.db"))
+	require.NoError(t, err)
+	now := time.Now().Truncate(time.Second)
+
+	require.NoError(t, h.Add(Record{Time: now.Add(-48 * time.Hour), Source: "/Desktop/Old Screenshot.png", Key: "old.jpg", URL: "https://foxy/old.jpg"}))
+	require.NoError(t, h.Add(Record{Time: now, Source: "/Desktop/New Screenshot.png", Key: "new.jpg", Destination: "s3", URL: "https://foxy/new.jpg", Size: 42}))
+
+	all, err := h.List(Filter{})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, uint64(1), all[0].ID)
+	assert.Equal(t, "old.jpg", all[0].Key)
+	assert.Equal(t, uint64(2), all[1].ID)
+	assert.True(t, now.Equal(all[1].Time))
+	assert.Equal(t, int64(42), all[1].Size)
+	assert.Equal(t, "s3", all[1].Destination)
+
+	recent, err := h.List(Filter{Since: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "new.jpg", recent[0].Key)
+
+	grep, err := h.List(Filter{Grep: "old screenshot"})
+	require.NoError(t, err)
+	require.Len(t, grep, 1)
+	assert.Equal(t, "old.jpg", grep[0].Key)
+}
+
+func TestHistory_MarkKeysRemoved(t *testing.T) {
+	h, err := New(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	require.NoError(t, h.Add(Record{Key: "shots/a.jpg", URL: "https://foxy/a.jpg"}))
+	require.NoError(t, h.Add(Record{Key: "shots/a.jpg", URL: "https://foxy/a.jpg?again"}))
+	require.NoError(t, h.Add(Record{Key: "b.jpg", Copies: []Location{{Destination: "archive", Key: "shots/b.jpg"}}}))
+	require.NoError(t, h.Add(Record{Key: "shots/c.jpg"}))
+
+	removed := time.Now().Truncate(time.Second)
+	marked, err := h.MarkKeysRemoved([]string{"shots/a.jpg", "shots/b.jpg"}, removed)
+	require.NoError(t, err)
+	assert.Equal(t, 3, marked, "deduplicated uploads share the key")
+
+	records, err := h.List(Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	for _, r := range records[:3] {
+		assert.True(t, removed.Equal(r.Removed), r.Key)
+	}
+	assert.True(t, records[3].Removed.IsZero())
+
+	marked, err = h.MarkKeysRemoved([]string{"shots/a.jpg"}, removed.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, marked, "removed records keep the first time")
+}
+
+func TestHistory_ListEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	h, err := New(path)
+	require.NoError(t, err)
+
+	records, err := h.List(Filter{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.NoFileExists(t, path, "listing must not create the database")
+}
+
+func TestHistory_FindAndMarkRemoved(t *testing.T) {
+	h, err := New(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+
+	require.NoError(t, h.Add(Record{Key: "first.jpg", Destination: "team", URL: "https://foxy/first.jpg"}))
+	require.NoError(t, h.Add(Record{
+		Key: "second.jpg", Destination: "team", URL: "https://foxy/second.jpg",
+		Copies: []Location{{Destination: "archive", Key: "archive-second.jpg"}},
+	}))
+
+	byURL, found, err := h.Find("https://foxy/first.jpg")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(1), byURL.ID)
+
+	byCopy, found, err := h.Find("archive-second.jpg")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []Location{{"team", "second.jpg"}, {"archive", "archive-second.jpg"}}, byCopy.Locations())
+
+	_, found, err = h.Find("missing.jpg")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	last, found, err := h.Last()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, uint64(2), last.ID)
+
+	removed := time.Now().Truncate(time.Second)
+	require.NoError(t, h.MarkRemoved(last.ID, removed))
+	last, found, err = h.Last()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, uint64(1), last.ID, "removed uploads are skipped")
+
+	again, _, err := h.Find("second.jpg")
+	require.NoError(t, err)
+	assert.True(t, removed.Equal(again.Removed))
+
+	assert.EqualError(t, h.MarkRemoved(42, removed), "history error, no record 42")
+
+	expires := removed.Add(72 * time.Hour)
+	require.NoError(t, h.SetLink(1, "https://foxy/first.jpg?renewed", expires))
+	renewed, found, err := h.Find("first.jpg")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "https://foxy/first.jpg?renewed", renewed.URL)
+	assert.True(t, expires.Equal(renewed.Expires))
+}
@@ -0,0 +1,70 @@
+package history
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+)
+
+// Recorder adds uploads to the history, failures are only logged since the screenshot is already uploaded
+type Recorder struct {
+	history *History
+	// destination is recorded for uploads to a single destination, their results have no name
+	destination string
+}
+
+// NewRecorder opens the history from config
+func NewRecorder(c *config.Config) (*Recorder, error) {
+	h, err := New(c.History.Path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{history: h}
+	if len(c.Destinations) == 0 {
+		r.destination = c.Destination.Name
+	}
+
+	return r, nil
+}
+
+// RecordRemoved marks uploads with the keys as removed, e.g. after the retention period
+func (r *Recorder) RecordRemoved(keys []string) {
+	if _, err := r.history.MarkKeysRemoved(keys, time.Now()); err != nil {
+		log.Printf("Cannot mark %d removed screenshots in history, %v \n", len(keys), err)
+	}
+}
+
+// RecordFile saves the upload of the processed file, it must not be removed yet
+func (r *Recorder) RecordFile(source, processed string, uploaded storage.Result) {
+	var size int64
+	if stat, err := os.Stat(processed); err == nil {
+		size = stat.Size()
+	}
+
+	r.Record(source, size, uploaded)
+}
+
+// Record saves the upload
+func (r *Recorder) Record(source string, size int64, uploaded storage.Result) {
+	record := Record{
+		Time:        time.Now(),
+		Source:      source,
+		Key:         uploaded.Key,
+		Destination: uploaded.Destination,
+		URL:         uploaded.URL,
+		Size:        size,
+		Expires:     uploaded.Expires,
+	}
+	if record.Destination == "" {
+		record.Destination = r.destination
+	}
+	for _, c := range uploaded.Copies {
+		record.Copies = append(record.Copies, Location{Destination: c.Destination, Key: c.Key})
+	}
+	if err := r.history.Add(record); err != nil {
+		log.Printf("Cannot add %s to history, %v \n", uploaded.URL, err)
+	}
+}
@@ -0,0 +1,41 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_RecordFile(t *testing.T) {
+	c := &config.Config{
+		Destination: config.Destination{Name: "s3"},
+		History:     config.HistoryConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "history.db")},
+	}
+	processed := filepath.Join(t.TempDir(), "processed")
+	require.NoError(t, os.WriteFile(processed, []byte("jpeg"), 0600))
+	r, err := NewRecorder(c)
+	require.NoError(t, err)
+
+	r.RecordFile("/Desktop/shot.png", processed, storage.Result{URL: "https://foxy/1.jpg", Key: "1.jpg"})
+	r.Record("/Desktop/queued.png", 10, storage.Result{
+		URL: "https://backup/2.jpg", Key: "2.jpg", Destination: "backup",
+		Copies: []storage.Result{{URL: "https://archive/2.jpg", Key: "a/2.jpg", Destination: "archive"}},
+	})
+
+	records, err := r.history.List(Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "/Desktop/shot.png", records[0].Source)
+	assert.Equal(t, "s3", records[0].Destination, "single destination uploads have no name in results")
+	assert.Equal(t, int64(4), records[0].Size)
+	assert.Equal(t, "1.jpg", records[0].Key)
+	assert.Equal(t, "backup", records[1].Destination)
+	assert.Equal(t, int64(10), records[1].Size)
+	assert.Equal(t, []Location{{Destination: "archive", Key: "a/2.jpg"}}, records[1].Copies)
+}
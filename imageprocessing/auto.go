@@ -0,0 +1,189 @@
+package imageprocessing
+
+import (
+	"errors"
+	"fmt"
+	"foxyshot/config"
+	"foxyshot/imageprocessing/webp"
+	"image"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// newAutoPipeline Creates ScreenshotPipeline that tries jpg, webp and png and keeps the smallest file
+// that is close enough to the screenshot, settings of the formats are used for the candidates
+func newAutoPipeline(c *config.Config) ScreenshotPipeline {
+	s := c.Screenshots
+	autoOptimizer := &autoOptimizer{
+		candidates: []candidate{
+			{config.FormatJPEG, &jpegOptimizer{
+				quality:    s.JpegQuality,
+				maxSize:    int64(s.MaxSizeKB) * 1024,
+				minQuality: s.JpegMinQuality,
+				maxQuality: s.JpegMaxQuality,
+				tmpFolder:  DefaultTmpFolder,
+				prefix:     DefaultPrefix,
+			}},
+			{config.FormatWebP, &webpOptimizer{quality: s.WebPQuality, lossless: s.WebPLossless, tmpFolder: DefaultTmpFolder, prefix: DefaultPrefix}},
+			{config.FormatPNG, &pngOptimizer{colors: s.PngColors, dither: s.PngDither, tmpFolder: DefaultTmpFolder, prefix: DefaultPrefix}},
+		},
+		reader:  &imageReader{},
+		minPSNR: s.MinPSNR,
+	}
+
+	return &readerOptimizer{reader: &imageReader{}, optimizer: autoOptimizer}
+}
+
+// candidate is one of the formats autoOptimizer chooses from
+type candidate struct {
+	name      string
+	optimizer screenshotOptimizer
+}
+
+// autoOptimizer encodes the image with every candidate in parallel and keeps the smallest file with PSNR of at least minPSNR
+// If no file is good enough, the one closest to the image is kept.
+type autoOptimizer struct {
+	candidates []candidate
+	reader     screenshotReader
+	minPSNR    float64
+}
+
+// encoded is a file written by a candidate
+type encoded struct {
+	name string
+	path string
+	size int64
+	psnr float64
+	err  error
+}
+
+func (opt *autoOptimizer) Optimize(img image.Image) (string, error) {
+	results := make([]encoded, len(opt.candidates))
+	var wg sync.WaitGroup
+	for i, c := range opt.candidates {
+		wg.Add(1)
+		go func(i int, c candidate) {
+			defer wg.Done()
+			results[i] = opt.encode(img, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	var errs []error
+	best := -1
+	for i, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+
+			continue
+		}
+		if best < 0 || opt.better(r, results[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", fmt.Errorf("auto optimization error, %w", errors.Join(errs...))
+	}
+
+	for i, r := range results {
+		if i != best && r.err == nil {
+			_ = os.Remove(r.path)
+		}
+	}
+	opt.logDecision(results, best)
+
+	return results[best].path, nil
+}
+
+// encode writes the candidate file and measures how close it is to the image
+func (opt *autoOptimizer) encode(img image.Image, c candidate) encoded {
+	path, err := c.optimizer.Optimize(img)
+	if err != nil {
+		return encoded{name: c.name, err: err}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		_ = os.Remove(path)
+
+		return encoded{name: c.name, err: fmt.Errorf("%s error, %w", c.name, err)}
+	}
+	decoded, err := opt.reader.Read(path)
+	if err != nil {
+		_ = os.Remove(path)
+
+		return encoded{name: c.name, err: err}
+	}
+
+	return encoded{name: c.name, path: path, size: info.Size(), psnr: psnr(img, decoded)}
+}
+
+// better prefers files that are good enough, then smaller ones; otherwise the closer one
+func (opt *autoOptimizer) better(a, b encoded) bool {
+	aGood, bGood := a.psnr >= opt.minPSNR, b.psnr >= opt.minPSNR
+	switch {
+	case aGood && bGood:
+		return a.size < b.size
+	case aGood != bGood:
+		return aGood
+	default:
+		return a.psnr > b.psnr
+	}
+}
+
+func (opt *autoOptimizer) logDecision(results []encoded, best int) {
+	summary := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			summary = append(summary, fmt.Sprintf("%s failed (%v)", r.name, r.err))
+
+			continue
+		}
+		summary = append(summary, fmt.Sprintf("%s %d bytes, %.1f dB", r.name, r.size, r.psnr))
+	}
+	reason := fmt.Sprintf("the smallest file with at least %.1f dB", opt.minPSNR)
+	if results[best].psnr < opt.minPSNR {
+		reason = fmt.Sprintf("no format reached %.1f dB", opt.minPSNR)
+	}
+	log.Printf("Picked %s for the screenshot, %s: %s\n", results[best].name, reason, strings.Join(summary, "; "))
+}
+
+// psnr compares colors of images of the same size, identical images get +Inf
+// Alpha only counts if either image has transparent pixels, colors are premultiplied then.
+func psnr(want, got image.Image) float64 {
+	// both are moved to the origin, so images with different bounds can be compared
+	a, b := webp.ToNRGBA(want), webp.ToNRGBA(got)
+	if a.Rect != b.Rect {
+		return 0
+	}
+
+	channels := 3
+	if !webp.Opaque(a) || !webp.Opaque(b) {
+		channels = 4
+	}
+	var sse float64
+	for i := 0; i < len(a.Pix); i += 4 {
+		for ch := 0; ch < channels; ch++ {
+			d := premultiplied(a.Pix[i:i+4], ch) - premultiplied(b.Pix[i:i+4], ch)
+			sse += d * d
+		}
+	}
+	if sse == 0 {
+		return math.Inf(1)
+	}
+	mse := sse / float64(len(a.Pix)/4*channels)
+
+	return 10 * math.Log10(255*255/mse)
+}
+
+// premultiplied returns the channel of a non-premultiplied pixel multiplied by its alpha
+func premultiplied(pixel []uint8, ch int) float64 {
+	if ch == 3 {
+		return float64(pixel[3])
+	}
+
+	return float64(pixel[ch]) * float64(pixel[3]) / 0xff
+}
@@ -0,0 +1,155 @@
+package imageprocessing
+
+import (
+	"errors"
+	"foxyshot/config"
+	"foxyshot/imageprocessing/internal/testimages"
+	"image"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingOptimizer struct{}
+
+func (opt *failingOptimizer) Optimize(image.Image) (string, error) {
+	return "", errors.New("failed")
+}
+
+func testAutoOptimizer(minPSNR float64, candidates ...candidate) *autoOptimizer {
+	return &autoOptimizer{candidates: candidates, reader: &imageReader{}, minPSNR: minPSNR}
+}
+
+func optimizedFormat(t *testing.T, f string) string {
+	file, err := os.Open(f)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	_, format, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+
+	return format
+}
+
+func TestNewAutoPipeline(t *testing.T) {
+	c := &config.Config{}
+	c.Screenshots.Format = config.FormatAuto
+
+	p := NewPipeline(c)
+	require.IsType(t, &readerOptimizer{}, p)
+	require.IsType(t, &autoOptimizer{}, p.(*readerOptimizer).optimizer)
+	assert.Len(t, p.(*readerOptimizer).optimizer.(*autoOptimizer).candidates, 3)
+}
+
+func TestAutoOptimizer_PicksSmallestGoodEnough(t *testing.T) {
+	before := testimages.Files(t, "testdata")
+	testOptimizer := testAutoOptimizer(40,
+		candidate{"png", &pngOptimizer{tmpFolder: "testdata", colors: 2}},
+		candidate{"best jpeg", &jpegOptimizer{tmpFolder: "testdata", quality: 100}},
+		candidate{"jpeg", &jpegOptimizer{tmpFolder: "testdata", quality: 90}},
+	)
+
+	f, err := testOptimizer.Optimize(testimages.Gradient(64, 64))
+	require.NoError(t, err)
+	testimages.Remove(t, f)
+
+	// the png is the smallest but not good enough, both jpegs are
+	assert.Equal(t, "jpeg", optimizedFormat(t, f))
+	picked, err := os.Stat(f)
+	require.NoError(t, err)
+	want, err := (&jpegOptimizer{tmpFolder: "testdata", quality: 90}).Optimize(testimages.Gradient(64, 64))
+	require.NoError(t, err)
+	testimages.Remove(t, want)
+	wantInfo, err := os.Stat(want)
+	require.NoError(t, err)
+	assert.Equal(t, wantInfo.Size(), picked.Size())
+	assert.Equal(t, before+2, testimages.Files(t, "testdata"), "other files are removed")
+}
+
+func TestAutoOptimizer_UIScreenshot(t *testing.T) {
+	testOptimizer := testAutoOptimizer(35,
+		candidate{"jpeg", &jpegOptimizer{tmpFolder: "testdata", quality: 30}},
+		candidate{"png", &pngOptimizer{tmpFolder: "testdata", colors: 256}},
+	)
+
+	f, err := testOptimizer.Optimize(testimages.UI(300, 200))
+	require.NoError(t, err)
+	testimages.Remove(t, f)
+
+	assert.Equal(t, "png", optimizedFormat(t, f))
+}
+
+func TestAutoOptimizer_LossyWebP(t *testing.T) {
+	testOptimizer := testAutoOptimizer(35,
+		candidate{"jpeg", &jpegOptimizer{tmpFolder: "testdata", quality: 95}},
+		candidate{"webp", &webpOptimizer{tmpFolder: "testdata", quality: 75}},
+	)
+
+	f, err := testOptimizer.Optimize(testimages.Text(300, 200))
+	require.NoError(t, err)
+	testimages.Remove(t, f)
+
+	assert.Equal(t, "webp", optimizedFormat(t, f))
+	decoded, err := (&imageReader{}).Read(f)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, psnr(testimages.Text(300, 200), decoded), 35.0)
+}
+
+func TestAutoOptimizer_NothingGoodEnough(t *testing.T) {
+	testOptimizer := testAutoOptimizer(math.Inf(1),
+		candidate{"png", &pngOptimizer{tmpFolder: "testdata", colors: 2}},
+		candidate{"jpeg", &jpegOptimizer{tmpFolder: "testdata", quality: 90}},
+		candidate{"broken", &failingOptimizer{}},
+	)
+
+	f, err := testOptimizer.Optimize(testimages.Gradient(64, 64))
+	require.NoError(t, err)
+	testimages.Remove(t, f)
+
+	assert.Equal(t, "jpeg", optimizedFormat(t, f), "the closest file is kept")
+}
+
+func TestAutoOptimizer_OptimizeError(t *testing.T) {
+	testOptimizer := testAutoOptimizer(35,
+		candidate{"broken", &failingOptimizer{}},
+		candidate{"png", &pngOptimizer{tmpFolder: "doesnotexist", colors: 256}},
+	)
+
+	f, err := testOptimizer.Optimize(mockImage)
+	assert.Empty(t, f)
+	assert.Regexp(t, "^auto optimization error, failed\npng error, .*no such file or directory$", err.Error())
+}
+
+func TestPSNR(t *testing.T) {
+	img := testimages.Gradient(16, 16)
+	assert.Equal(t, math.Inf(1), psnr(img, img.SubImage(img.Rect)))
+	assert.Equal(t, 0.0, psnr(img, testimages.Gradient(16, 8)))
+
+	shifted := testimages.Gradient(16, 16)
+	shifted.Rect = image.Rect(5, 5, 21, 21)
+	assert.Equal(t, math.Inf(1), psnr(img, shifted))
+
+	noisy := testimages.Gradient(16, 16)
+	for i := 0; i < len(noisy.Pix); i += 4 {
+		noisy.Pix[i] ^= 1
+	}
+	// only R of every pixel is off by one, alpha is not compared
+	assert.InDelta(t, 10*math.Log10(3*255*255), psnr(img, noisy), 0.01)
+
+	transparent, recolored := testimages.Gradient(16, 16), testimages.Gradient(16, 16)
+	for i := 0; i < len(transparent.Pix); i += 4 {
+		transparent.Pix[i+3], recolored.Pix[i+3] = 0, 0
+		recolored.Pix[i] ^= 0xff
+	}
+	// colors of transparent pixels are premultiplied to zero
+	assert.Equal(t, math.Inf(1), psnr(transparent, recolored))
+
+	black := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 0xff
+	}
+	// only alpha differs, by 255 in every pixel
+	assert.InDelta(t, 10*math.Log10(4), psnr(black, image.NewNRGBA(black.Rect)), 0.01)
+}
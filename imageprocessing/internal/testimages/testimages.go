@@ -0,0 +1,106 @@
+// Package testimages generates images for the imageprocessing tests and removes the files they write
+package testimages
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Gradient has a different color in almost every pixel
+func Gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: uint8((x + y) % 256), A: 0xff})
+		}
+	}
+
+	return img
+}
+
+// UI draws a few flat colors like windows and buttons
+func UI(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 0xee, G: 0xee, B: 0xee, A: 0xff}
+			if (x/4+y/6)%5 == 0 {
+				c = color.NRGBA{R: 0x20, G: 0x30, B: 0x90, A: 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// Text draws dark strokes like letters on a light window under a gradient toolbar
+func Text(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := text(x, y)
+			if y < h/5 {
+				c = color.NRGBA{R: uint8(200 + x*50/w), G: uint8(200 + y*50/h), B: 0xf0, A: 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// Screenshot draws a photo-like gradient with a noisy corner on the left and Text on the right
+func Screenshot(w, h int, alpha bool) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 200, A: 0xff}
+			if x < w/4 && y < h/4 {
+				// brightness noise, chroma noise would not survive subsampling at any quality
+				n := rnd.Intn(49) - 24
+				c.R, c.G, c.B = clamp(int(c.R)+n), clamp(int(c.G)+n), clamp(int(c.B)+n)
+			}
+			if x >= w/2 {
+				c = text(x, y)
+			}
+			if alpha && x > w/2 {
+				c.A = uint8(x * 255 / w)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+// Remove deletes the file when the test and its subtests finish
+func Remove(t testing.TB, name string) {
+	t.Cleanup(func() { _ = os.Remove(name) })
+}
+
+// Files returns the number of files in dir
+func Files(t testing.TB, dir string) int {
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	return len(files)
+}
+
+func text(x, y int) color.NRGBA {
+	if (x/3+y/5)%4 == 0 && y%9 > 2 {
+		return color.NRGBA{R: 20, G: 20, B: 20, A: 0xff}
+	}
+
+	return color.NRGBA{R: 0xf4, G: 0xf4, B: 0xf0, A: 0xff}
+}
+
+func clamp(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
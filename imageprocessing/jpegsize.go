@@ -0,0 +1,80 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// fit returns the best quality jpg of at most maxSize bytes
+// If even minQuality is too large, the image is downscaled until it fits.
+func (opt *jpegOptimizer) fit(img image.Image) ([]byte, error) {
+	scaled := img
+	for {
+		data, size, err := opt.bestQuality(scaled)
+		if err != nil || data != nil {
+			return data, err
+		}
+
+		// the size of a jpg grows with the area, some margin saves another round
+		b, sb := img.Bounds(), scaled.Bounds()
+		factor := math.Sqrt(float64(opt.maxSize)/float64(size)) * 0.9
+		w, h := max(int(float64(sb.Dx())*factor), 1), max(int(float64(sb.Dy())*factor), 1)
+		if w == sb.Dx() && h == sb.Dy() {
+			return nil, fmt.Errorf("%dx%d image does not fit into %d bytes", w, h, opt.maxSize)
+		}
+
+		// always scaled from the original, so the image is not blurred several times
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Rect, img, b, draw.Src, nil)
+		scaled = dst
+		log.Printf("Screenshot is larger than %d bytes with quality %d, downscaling it to %dx%d\n", opt.maxSize, opt.minQuality, w, h)
+	}
+}
+
+// bestQuality binary searches the highest quality that fits into maxSize
+// It returns no data and the size with minQuality if the image does not fit at all.
+func (opt *jpegOptimizer) bestQuality(img image.Image) ([]byte, int, error) {
+	best, err := encodeJpeg(img, opt.minQuality)
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(best)) > opt.maxSize {
+		return nil, len(best), nil
+	}
+
+	quality := opt.minQuality
+	low, high := opt.minQuality+1, opt.maxQuality
+	for low <= high {
+		mid := (low + high) / 2
+		data, err := encodeJpeg(img, mid)
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(data)) <= opt.maxSize {
+			best, quality, low = data, mid, mid+1
+		} else {
+			high = mid - 1
+		}
+	}
+
+	if opt.verbose {
+		log.Printf("Using jpeg quality %d, %d bytes\n", quality, len(best))
+	}
+
+	return best, len(best), nil
+}
+
+func encodeJpeg(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
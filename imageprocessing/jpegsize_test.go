@@ -0,0 +1,78 @@
+package imageprocessing
+
+import (
+	"foxyshot/config"
+	"foxyshot/imageprocessing/internal/testimages"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMaxSizeJpgPipeline(t *testing.T) {
+	c := &config.Config{}
+	c.Screenshots.MaxSizeKB = 300
+	c.Screenshots.JpegMinQuality, c.Screenshots.JpegMaxQuality = 10, 90
+
+	p := NewPipeline(c)
+	require.IsType(t, &readerOptimizer{}, p)
+	opt := p.(*readerOptimizer).optimizer
+	require.IsType(t, &jpegOptimizer{}, opt)
+	assert.Equal(t, int64(300*1024), opt.(*jpegOptimizer).maxSize)
+}
+
+func TestJpegOptimizer_BestQuality(t *testing.T) {
+	img := testimages.Gradient(200, 200)
+	q50, err := encodeJpeg(img, 50)
+	require.NoError(t, err)
+	q51, err := encodeJpeg(img, 51)
+	require.NoError(t, err)
+	require.Less(t, len(q50), len(q51))
+
+	testOptimizer := &jpegOptimizer{maxSize: int64(len(q50)), minQuality: 10, maxQuality: 90}
+	data, size, err := testOptimizer.bestQuality(img)
+	require.NoError(t, err)
+	assert.Equal(t, q50, data)
+	assert.Equal(t, len(q50), size)
+
+	testOptimizer.maxQuality = 40
+	data, _, err = testOptimizer.bestQuality(img)
+	require.NoError(t, err)
+	q40, err := encodeJpeg(img, 40)
+	require.NoError(t, err)
+	assert.Equal(t, q40, data, "the quality is not above the maximum")
+}
+
+func TestJpegOptimizer_OptimizeMaxSize(t *testing.T) {
+	img := testimages.Gradient(400, 300)
+	q10, err := encodeJpeg(img, 10)
+	require.NoError(t, err)
+
+	testOptimizer := &jpegOptimizer{tmpFolder: "testdata", maxSize: int64(len(q10)) / 3, minQuality: 10, maxQuality: 90}
+	f, err := testOptimizer.Optimize(img)
+	require.NoError(t, err)
+	testimages.Remove(t, f)
+
+	info, err := os.Stat(f)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), testOptimizer.maxSize)
+
+	file, err := os.Open(f)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	decoded, format, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Less(t, decoded.Width, 400, "the image is downscaled")
+	assert.InDelta(t, 4.0/3.0, float64(decoded.Width)/float64(decoded.Height), 0.02, "the aspect ratio is kept")
+}
+
+func TestJpegOptimizer_OptimizeMaxSizeError(t *testing.T) {
+	testOptimizer := &jpegOptimizer{tmpFolder: "testdata", maxSize: 10, minQuality: 10, maxQuality: 90}
+
+	f, err := testOptimizer.Optimize(testimages.Gradient(40, 40))
+	assert.Empty(t, f)
+	assert.EqualError(t, err, "jpeg optimization error, 1x1 image does not fit into 10 bytes")
+}
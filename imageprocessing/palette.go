@@ -0,0 +1,304 @@
+package imageprocessing
+
+import (
+	"foxyshot/imageprocessing/webp"
+	"image"
+	"image/color"
+	"sort"
+)
+
+// paletted converts img to an image with at most maxColors colors
+// Images that already have few enough colors, like most UI screenshots, keep every pixel.
+func paletted(img image.Image, maxColors int, dither bool) *image.Paletted {
+	// a shallow copy moved back to the bounds of img, so the paletted image keeps them
+	src := *webp.ToNRGBA(img)
+	src.Rect = img.Bounds()
+	b := src.Bounds()
+
+	palette, exact := exactPalette(&src, maxColors)
+	if exact {
+		dst := image.NewPaletted(b, palette)
+		indexes := make(map[uint32]uint8, len(palette))
+		for i, c := range palette {
+			indexes[packColor(c.(color.NRGBA))] = uint8(i)
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				dst.SetColorIndex(x, y, indexes[packColor(src.NRGBAAt(x, y))])
+			}
+		}
+
+		return dst
+	}
+
+	palette = medianCut(&src, maxColors)
+	if dither {
+		return floydSteinberg(&src, palette)
+	}
+	dst := image.NewPaletted(b, palette)
+	lookup := newPaletteLookup(palette)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.SetColorIndex(x, y, lookup.index(src.NRGBAAt(x, y)))
+		}
+	}
+
+	return dst
+}
+
+// floydSteinberg maps pixels to the palette and spreads the error to the pixels not mapped yet
+// The bucket cache is not used, the error of a bucket color would be spread instead of the real one.
+func floydSteinberg(src *image.NRGBA, palette color.Palette) *image.Paletted {
+	b := src.Bounds()
+	dst := image.NewPaletted(b, palette)
+	cache := make(map[uint32]uint8)
+
+	// errors of the current and the next row, with a pixel of padding on both sides
+	w := b.Dx()
+	current, next := make([][4]int32, w+2), make([][4]int32, w+2)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := x - b.Min.X + 1
+			c := src.NRGBAAt(x, y)
+			var want [4]int32
+			for ch, v := range [4]uint8{c.R, c.G, c.B, c.A} {
+				want[ch] = min(max(int32(v)+(current[i][ch]+8)>>4, 0), 255)
+			}
+
+			c = color.NRGBA{R: uint8(want[0]), G: uint8(want[1]), B: uint8(want[2]), A: uint8(want[3])}
+			index, ok := cache[packColor(c)]
+			if !ok {
+				index = nearest(palette, c)
+				cache[packColor(c)] = index
+			}
+			dst.SetColorIndex(x, y, index)
+			got := palette[index].(color.NRGBA)
+			for ch, v := range [4]uint8{got.R, got.G, got.B, got.A} {
+				e := want[ch] - int32(v)
+				current[i+1][ch] += 7 * e
+				next[i-1][ch] += 3 * e
+				next[i][ch] += 5 * e
+				next[i+1][ch] += e
+			}
+		}
+		current, next = next, current
+		clear(next)
+	}
+
+	return dst
+}
+
+// exactPalette lists the colors of the image unless there are more than maxColors of them
+func exactPalette(img *image.NRGBA, maxColors int) (color.Palette, bool) {
+	b := img.Bounds()
+	seen := make(map[uint32]struct{}, maxColors+1)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			seen[packColor(img.NRGBAAt(x, y))] = struct{}{}
+			if len(seen) > maxColors {
+				return nil, false
+			}
+		}
+	}
+
+	keys := make([]uint32, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	// sorted, so the same screenshot always produces the same file
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	palette := make(color.Palette, len(keys))
+	for i, key := range keys {
+		palette[i] = color.NRGBA{R: uint8(key >> 24), G: uint8(key >> 16), B: uint8(key >> 8), A: uint8(key)}
+	}
+
+	return palette, true
+}
+
+// histogramBucket collects similar colors
+type histogramBucket struct {
+	count uint64
+	sum   [4]uint64
+	mean  [4]uint8
+}
+
+// colorBox is a group of buckets that becomes a single palette color
+type colorBox struct {
+	buckets []*histogramBucket
+	count   uint64
+}
+
+// medianCut splits the histogram of the image into maxColors boxes and returns their average colors
+// The box with the most pixels over the widest channel is split at the median of that channel.
+func medianCut(img *image.NRGBA, maxColors int) color.Palette {
+	b := img.Bounds()
+	histogram := make(map[uint32]*histogramBucket)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			key := bucketKey(c)
+			bucket, ok := histogram[key]
+			if !ok {
+				bucket = &histogramBucket{}
+				histogram[key] = bucket
+			}
+			bucket.count++
+			for i, v := range [4]uint8{c.R, c.G, c.B, c.A} {
+				bucket.sum[i] += uint64(v)
+			}
+		}
+	}
+
+	box := colorBox{buckets: make([]*histogramBucket, 0, len(histogram))}
+	for _, bucket := range histogram {
+		for i := range bucket.mean {
+			bucket.mean[i] = uint8(bucket.sum[i] / bucket.count)
+		}
+		box.buckets = append(box.buckets, bucket)
+		box.count += bucket.count
+	}
+	sort.Slice(box.buckets, func(i, j int) bool {
+		return packMean(box.buckets[i]) < packMean(box.buckets[j])
+	})
+
+	boxes := []colorBox{box}
+	for len(boxes) < maxColors {
+		best, bestScore, channel := -1, uint64(0), 0
+		for i, box := range boxes {
+			if len(box.buckets) < 2 {
+				continue
+			}
+			ch, width := box.widestChannel()
+			if score := box.count * uint64(width); score > bestScore {
+				best, bestScore, channel = i, score, ch
+			}
+		}
+		if best < 0 {
+			break
+		}
+		low, high := boxes[best].split(channel)
+		boxes[best] = low
+		boxes = append(boxes, high)
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		palette[i] = box.average()
+	}
+
+	return palette
+}
+
+func (box colorBox) widestChannel() (int, uint8) {
+	channel, width := 0, uint8(0)
+	for ch := 0; ch < 4; ch++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, bucket := range box.buckets {
+			lo, hi = min(lo, bucket.mean[ch]), max(hi, bucket.mean[ch])
+		}
+		if hi-lo > width {
+			channel, width = ch, hi-lo
+		}
+	}
+
+	return channel, width
+}
+
+// split divides the box at the pixel median of the channel, both halves get at least one bucket
+func (box colorBox) split(channel int) (colorBox, colorBox) {
+	sort.SliceStable(box.buckets, func(i, j int) bool {
+		return box.buckets[i].mean[channel] < box.buckets[j].mean[channel]
+	})
+
+	var count uint64
+	at := 1
+	for ; at < len(box.buckets)-1; at++ {
+		count += box.buckets[at-1].count
+		if 2*count >= box.count {
+			break
+		}
+	}
+
+	low := colorBox{buckets: box.buckets[:at:at]}
+	high := colorBox{buckets: box.buckets[at:]}
+	for _, bucket := range low.buckets {
+		low.count += bucket.count
+	}
+	high.count = box.count - low.count
+
+	return low, high
+}
+
+func (box colorBox) average() color.NRGBA {
+	var sum [4]uint64
+	for _, bucket := range box.buckets {
+		for i := range sum {
+			sum[i] += bucket.sum[i]
+		}
+	}
+	// rounded, so boxes of a single color get exactly that color
+	half := box.count / 2
+
+	return color.NRGBA{
+		R: uint8((sum[0] + half) / box.count),
+		G: uint8((sum[1] + half) / box.count),
+		B: uint8((sum[2] + half) / box.count),
+		A: uint8((sum[3] + half) / box.count),
+	}
+}
+
+// paletteLookup caches the nearest palette colors of histogram buckets
+// Colors of a bucket differ by a few levels, so searching the palette once per bucket is enough.
+type paletteLookup struct {
+	palette color.Palette
+	cache   []int16
+}
+
+func newPaletteLookup(palette color.Palette) *paletteLookup {
+	cache := make([]int16, 1<<18)
+	for i := range cache {
+		cache[i] = -1
+	}
+
+	return &paletteLookup{palette: palette, cache: cache}
+}
+
+func (l *paletteLookup) index(c color.NRGBA) uint8 {
+	key := bucketKey(c)
+	if l.cache[key] < 0 {
+		l.cache[key] = int16(nearest(l.palette, c))
+	}
+
+	return uint8(l.cache[key])
+}
+
+// nearest returns the index of the palette color closest to c
+func nearest(palette color.Palette, c color.NRGBA) uint8 {
+	best, bestDistance := 0, -1
+	for i, p := range palette {
+		pc := p.(color.NRGBA)
+		d := sq(int(c.R)-int(pc.R)) + sq(int(c.G)-int(pc.G)) + sq(int(c.B)-int(pc.B)) + sq(int(c.A)-int(pc.A))
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+
+	return uint8(best)
+}
+
+func sq(v int) int {
+	return v * v
+}
+
+// bucketKey reduces color channels to 5 bits and alpha to 3 bits
+func bucketKey(c color.NRGBA) uint32 {
+	return uint32(c.R>>3)<<13 | uint32(c.G>>3)<<8 | uint32(c.B>>3)<<3 | uint32(c.A>>5)
+}
+
+func packColor(c color.NRGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+func packMean(bucket *histogramBucket) uint32 {
+	return packColor(color.NRGBA{R: bucket.mean[0], G: bucket.mean[1], B: bucket.mean[2], A: bucket.mean[3]})
+}
@@ -0,0 +1,79 @@
+package imageprocessing
+
+import (
+	"foxyshot/imageprocessing/internal/testimages"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaletted_ExactColors(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(3, 4, 43, 24))
+	colors := []color.NRGBA{{R: 0xff, A: 0xff}, {G: 0x80, A: 0xff}, {B: 0x10, A: 0x40}, {}}
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			img.SetNRGBA(x, y, colors[(x+y/3)%len(colors)])
+		}
+	}
+
+	for _, dither := range []bool{false, true} {
+		m := paletted(img, len(colors), dither)
+
+		require.Equal(t, img.Rect, m.Rect)
+		assert.Len(t, m.Palette, len(colors))
+		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				require.Equal(t, img.NRGBAAt(x, y), m.At(x, y), "pixel %d,%d", x, y)
+			}
+		}
+	}
+}
+
+func TestPaletted_Quantize(t *testing.T) {
+	img := testimages.Gradient(64, 64)
+
+	for _, dither := range []bool{false, true} {
+		m := paletted(img, 32, dither)
+
+		assert.Len(t, m.Palette, 32)
+		var sse float64
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				want, got := img.NRGBAAt(x, y), m.At(x, y).(color.NRGBA)
+				for _, d := range []int{int(want.R) - int(got.R), int(want.G) - int(got.G), int(want.B) - int(got.B)} {
+					sse += float64(d * d)
+				}
+			}
+		}
+		// a random palette is off by about 100 per channel
+		assert.Less(t, sse/(3*64*64), 400.0, "dither %v", dither)
+	}
+}
+
+func TestPaletted_Gray(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		img.Pix[x] = uint8(x)
+	}
+
+	m := paletted(img, 16, false)
+
+	assert.Len(t, m.Palette, 16)
+	for x := 0; x < 256; x++ {
+		got := m.At(x, 0).(color.NRGBA)
+		assert.Equal(t, got.R, got.G)
+		assert.InDelta(t, x, int(got.R), 16)
+	}
+}
+
+func TestMedianCut_FewerColors(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 0xff, A: 0xff})
+
+	palette := medianCut(img, 256)
+
+	assert.ElementsMatch(t, color.Palette{color.NRGBA{}, color.NRGBA{R: 0xff, A: 0xff}}, palette)
+}
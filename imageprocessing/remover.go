@@ -1,6 +1,7 @@
 package imageprocessing
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -29,6 +30,11 @@ func (p *RemoverPipeline) Run(path string) (string, error) {
 	return processed, nil
 }
 
+// RunReader has no original file to remove, so it only runs the internal pipeline
+func (p *RemoverPipeline) RunReader(r io.Reader) (string, error) {
+	return p.pipeline.RunReader(r)
+}
+
 type remover interface {
 	Remove(path string)
 }
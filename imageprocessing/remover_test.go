@@ -3,8 +3,10 @@ package imageprocessing
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 
@@ -64,6 +66,22 @@ func (r *pipelineMock) Run(path string) (string, error) {
 	return r.returnPath, nil
 }
 
+func (r *pipelineMock) RunReader(_ io.Reader) (string, error) {
+	return r.Run("stdin")
+}
+
+func TestRemoverPipeline_RunReader(t *testing.T) {
+	mockRemover := &removerMock{}
+	mockPipeline := &pipelineMock{returnPath: "expected_processed_path"}
+	rp := RemoverPipeline{remover: mockRemover, pipeline: mockPipeline}
+
+	processed, err := rp.RunReader(strings.NewReader("image"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "expected_processed_path", processed)
+	assert.Equal(t, "", mockRemover.PathCalled, "nothing to remove")
+}
+
 func TestRemoverPipeline_Run(t *testing.T) {
 	mockRemover := &removerMock{}
 	mockPipeline := &pipelineMock{returnPath: "expected_processed_path"}
@@ -3,11 +3,20 @@ package imageprocessing
 import (
 	"fmt"
 	"foxyshot/config"
+	"foxyshot/imageprocessing/webp"
 	"image"
+	// decoders are registered for imageReader
+	_ "image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"log"
 	"os"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	// the decoder is registered by the blank import, the encoder is in imageprocessing/webp
+	_ "golang.org/x/image/webp"
 )
 
 const (
@@ -19,7 +28,21 @@ const (
 
 // NewPipeline uses config to construct the pipeline
 func NewPipeline(c *config.Config) ScreenshotPipeline {
-	p := newJpgPipeline(c.Screenshots.JpegQuality)
+	var p ScreenshotPipeline
+	switch c.Screenshots.Format {
+	case config.FormatWebP:
+		p = newWebPPipeline(c.Screenshots.WebPQuality, c.Screenshots.WebPLossless, c.Screenshots.JpegQuality)
+	case config.FormatPNG:
+		p = newPngPipeline(c.Screenshots.PngColors, c.Screenshots.PngDither)
+	case config.FormatAuto:
+		p = newAutoPipeline(c)
+	default:
+		if c.Screenshots.MaxSizeKB > 0 {
+			p = newMaxSizeJpgPipeline(int64(c.Screenshots.MaxSizeKB)*1024, c.Screenshots.JpegMinQuality, c.Screenshots.JpegMaxQuality)
+		} else {
+			p = newJpgPipeline(c.Screenshots.JpegQuality)
+		}
+	}
 	if c.Screenshots.RemoveOriginals {
 		return newRemoverPipeline(p)
 	}
@@ -28,10 +51,12 @@ func NewPipeline(c *config.Config) ScreenshotPipeline {
 }
 
 // ScreenshotPipeline is an interface to optimization pipeline for images
-// Currently only PNG - JPG pipeline is supported
+// PNG, JPEG, GIF, BMP, TIFF and WebP images are converted to JPG, WebP or PNG
 type ScreenshotPipeline interface {
 	// Run accepts path to an existing image and returns path to an optimized image
 	Run(path string) (string, error)
+	// RunReader accepts an encoded image, e.g. piped to stdin, and returns path to an optimized image
+	RunReader(r io.Reader) (string, error)
 }
 
 type readerOptimizer struct {
@@ -48,6 +73,15 @@ func (pipeline *readerOptimizer) Run(path string) (string, error) {
 	return pipeline.optimizer.Optimize(img)
 }
 
+func (pipeline *readerOptimizer) RunReader(r io.Reader) (string, error) {
+	img, err := pipeline.reader.Decode(r)
+	if err != nil {
+		return "", err
+	}
+
+	return pipeline.optimizer.Optimize(img)
+}
+
 // newJpgPipeline Creates ScreenshotPipeline that converts images into jpgs
 // for MacOS quality 30 seems to be sufficient for screenshots and provides up to 90% savings in file size
 func newJpgPipeline(quality int) ScreenshotPipeline {
@@ -56,9 +90,50 @@ func newJpgPipeline(quality int) ScreenshotPipeline {
 		tmpFolder: DefaultTmpFolder,
 		prefix:    DefaultPrefix,
 	}
-	pngReader := &pngReader{}
+	imageReader := &imageReader{}
+
+	return &readerOptimizer{reader: imageReader, optimizer: jpegOptimizer}
+}
+
+// newMaxSizeJpgPipeline Creates ScreenshotPipeline that converts images into jpgs of at most maxSize bytes
+// the best quality between minQuality and maxQuality that fits is used, larger screenshots are downscaled
+func newMaxSizeJpgPipeline(maxSize int64, minQuality, maxQuality int) ScreenshotPipeline {
+	jpegOptimizer := &jpegOptimizer{
+		maxSize:    maxSize,
+		minQuality: minQuality,
+		maxQuality: maxQuality,
+		tmpFolder:  DefaultTmpFolder,
+		prefix:     DefaultPrefix,
+	}
+
+	return &readerOptimizer{reader: &imageReader{}, optimizer: jpegOptimizer}
+}
+
+// newWebPPipeline Creates ScreenshotPipeline that converts images into webps
+// lossless webps are usually smaller than pngs, images too large for webp are saved as jpgs with jpegQuality
+func newWebPPipeline(quality int, lossless bool, jpegQuality int) ScreenshotPipeline {
+	webpOptimizer := &webpOptimizer{
+		quality:   quality,
+		lossless:  lossless,
+		tmpFolder: DefaultTmpFolder,
+		prefix:    DefaultPrefix,
+		fallback:  &jpegOptimizer{quality: jpegQuality, tmpFolder: DefaultTmpFolder, prefix: DefaultPrefix},
+	}
+
+	return &readerOptimizer{reader: &imageReader{}, optimizer: webpOptimizer}
+}
+
+// newPngPipeline Creates ScreenshotPipeline that converts images into pngs with a palette
+// UI screenshots rarely have more than 256 colors, so they stay pixel-perfect and are often smaller than jpgs
+func newPngPipeline(colors int, dither bool) ScreenshotPipeline {
+	pngOptimizer := &pngOptimizer{
+		colors:    colors,
+		dither:    dither,
+		tmpFolder: DefaultTmpFolder,
+		prefix:    DefaultPrefix,
+	}
 
-	return &readerOptimizer{reader: pngReader, optimizer: jpegOptimizer}
+	return &readerOptimizer{reader: &imageReader{}, optimizer: pngOptimizer}
 }
 
 // screenshotOptimizer is an interface for optimizing screenshot images
@@ -69,14 +144,27 @@ type screenshotOptimizer interface {
 }
 
 // jpegOptimizer saves image to jpg with a specified quality
+// With maxSize the quality is searched between minQuality and maxQuality instead, see fit.
 type jpegOptimizer struct {
-	tmpFolder string
-	prefix    string
-	quality   int
-	verbose   bool
+	tmpFolder  string
+	prefix     string
+	quality    int
+	maxSize    int64
+	minQuality int
+	maxQuality int
+	verbose    bool
 }
 
 func (opt *jpegOptimizer) Optimize(img image.Image) (string, error) {
+	var data []byte
+	if opt.maxSize > 0 {
+		var err error
+		data, err = opt.fit(img)
+		if err != nil {
+			return "", fmt.Errorf("jpeg optimization error, %w", err)
+		}
+	}
+
 	file, err := os.CreateTemp(opt.tmpFolder, opt.prefix)
 	if err != nil {
 		return "", fmt.Errorf("jpeg error, %w", err)
@@ -86,8 +174,13 @@ func (opt *jpegOptimizer) Optimize(img image.Image) (string, error) {
 		log.Println("Saving compressed screenshot ", file.Name())
 	}
 
-	err = jpeg.Encode(file, img, &jpeg.Options{Quality: opt.quality})
+	if data != nil {
+		_, err = file.Write(data)
+	} else {
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: opt.quality})
+	}
 	if err != nil {
+		_ = file.Close()
 		rerr := os.Remove(file.Name())
 		if rerr != nil {
 			return "", fmt.Errorf("invalid jpeg removal error %v, original reason %w", rerr, err)
@@ -102,29 +195,124 @@ func (opt *jpegOptimizer) Optimize(img image.Image) (string, error) {
 	return file.Name(), nil
 }
 
+// webpOptimizer saves image to webp, lossy with a specified quality or lossless
+type webpOptimizer struct {
+	tmpFolder string
+	prefix    string
+	quality   int
+	lossless  bool
+	verbose   bool
+	// fallback saves images larger than webp.MaxSize, they fail without it
+	fallback screenshotOptimizer
+}
+
+func (opt *webpOptimizer) Optimize(img image.Image) (string, error) {
+	if b := img.Bounds(); opt.fallback != nil && (b.Dx() > webp.MaxSize || b.Dy() > webp.MaxSize) {
+		log.Printf("Screenshot is %dx%d, webp images are at most %dx%d, saving it as jpeg \n", b.Dx(), b.Dy(), webp.MaxSize, webp.MaxSize)
+
+		return opt.fallback.Optimize(img)
+	}
+
+	file, err := os.CreateTemp(opt.tmpFolder, opt.prefix)
+	if err != nil {
+		return "", fmt.Errorf("webp error, %w", err)
+	}
+
+	if opt.verbose {
+		log.Println("Saving compressed screenshot ", file.Name())
+	}
+
+	err = webp.Encode(file, img, &webp.Options{Quality: opt.quality, Lossless: opt.lossless})
+	if err != nil {
+		_ = file.Close()
+		rerr := os.Remove(file.Name())
+		if rerr != nil {
+			return "", fmt.Errorf("invalid webp removal error %v, original reason %w", rerr, err)
+		}
+
+		return "", fmt.Errorf("webp optimization error, %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("webp error, %w", err)
+	}
+
+	return file.Name(), nil
+}
+
+// pngOptimizer saves image to a png with the best compression and at most colors colors
+// Images with more colors are quantized with median cut, optionally with dithering.
+type pngOptimizer struct {
+	tmpFolder string
+	prefix    string
+	colors    int
+	dither    bool
+	verbose   bool
+}
+
+func (opt *pngOptimizer) Optimize(img image.Image) (string, error) {
+	file, err := os.CreateTemp(opt.tmpFolder, opt.prefix)
+	if err != nil {
+		return "", fmt.Errorf("png error, %w", err)
+	}
+
+	if opt.verbose {
+		log.Println("Saving compressed screenshot ", file.Name())
+	}
+
+	encoder := &png.Encoder{CompressionLevel: png.BestCompression}
+	err = encoder.Encode(file, paletted(img, opt.colors, opt.dither))
+	if err != nil {
+		_ = file.Close()
+		rerr := os.Remove(file.Name())
+		if rerr != nil {
+			return "", fmt.Errorf("invalid png removal error %v, original reason %w", rerr, err)
+		}
+
+		return "", fmt.Errorf("png optimization error, %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("png error, %w", err)
+	}
+
+	return file.Name(), nil
+}
+
 // screenshotReader is an interface for reading screenshots into an image.Image
 type screenshotReader interface {
 	Read(path string) (image.Image, error)
+	Decode(r io.Reader) (image.Image, error)
 }
 
-type pngReader struct{}
+// imageReader detects the format by the first bytes of the image, so the file extension does not matter
+type imageReader struct{}
 
-func (reader *pngReader) Read(path string) (img image.Image, err error) {
+func (reader *imageReader) Read(path string) (img image.Image, err error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("png error, %w", err)
+		return nil, fmt.Errorf("image error, %w", err)
 	}
 	defer func(file *os.File) {
 		cerr := file.Close()
 		if cerr != nil {
-			err = fmt.Errorf("png error, cannot close file - %w", cerr) // passing error to the top
+			err = fmt.Errorf("image error, cannot close file - %w", cerr) // passing error to the top
 		}
 	}(file)
 
-	// TODO check if using image.Decode makes sense - which format do Monosnap, Joxi etc. use?
-	img, err = png.Decode(file)
+	return reader.Decode(file)
+}
+
+func (reader *imageReader) Decode(r io.Reader) (image.Image, error) {
+	img, format, err := image.Decode(r)
 	if err != nil {
-		return nil, fmt.Errorf("png error, %w", err)
+		// the format is empty if it is not recognized
+		if format == "" {
+			format = "image"
+		}
+
+		return nil, fmt.Errorf("%s error, %w", format, err)
+	}
+	if format == "webp" {
+		img = webp.ConvertDecoded(img)
 	}
 
 	return img, nil
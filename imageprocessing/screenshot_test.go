@@ -1,21 +1,25 @@
 package imageprocessing
 
 import (
+	"bytes"
 	"fmt"
 	"foxyshot/config"
 	"image"
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-var invalidPngData = []struct {
+var invalidImageData = []struct {
 	file   string
 	errMsg string
 }{
-	{"testdata/notanimage", "png error, unexpected EOF"},
-	{"doesnotexist", "png error, open doesnotexist: no such file or directory"},
+	{"testdata/notanimage", "image error, image: unknown format"},
+	{"doesnotexist", "image error, open doesnotexist: no such file or directory"},
 }
 
 func TestNewPipeline(t *testing.T) {
@@ -28,24 +32,54 @@ func TestNewPipeline(t *testing.T) {
 
 	remove := NewPipeline(c)
 	assert.IsType(t, &RemoverPipeline{}, remove)
+
+	c.Screenshots.RemoveOriginals = false
+	c.Screenshots.Format = config.FormatWebP
+
+	webp := NewPipeline(c)
+	require.IsType(t, &readerOptimizer{}, webp)
+	require.IsType(t, &webpOptimizer{}, webp.(*readerOptimizer).optimizer)
+	assert.IsType(t, &jpegOptimizer{}, webp.(*readerOptimizer).optimizer.(*webpOptimizer).fallback)
+
+	c.Screenshots.Format = config.FormatPNG
+
+	png := NewPipeline(c)
+	require.IsType(t, &readerOptimizer{}, png)
+	assert.IsType(t, &pngOptimizer{}, png.(*readerOptimizer).optimizer)
 }
 
-func TestPngReader_ReadInvalidData(t *testing.T) {
-	testReader := &pngReader{}
+func TestImageReader_ReadInvalidData(t *testing.T) {
+	testReader := &imageReader{}
 
-	for _, d := range invalidPngData {
+	for _, d := range invalidImageData {
 		img, err := testReader.Read(d.file)
 		assert.Nil(t, img)
 		assert.EqualError(t, err, d.errMsg)
 	}
 }
 
-func TestPngReader_ReadValidData(t *testing.T) {
-	testReader := &pngReader{}
-	img, err := testReader.Read("testdata/valid.png")
+func TestImageReader_ReadValidData(t *testing.T) {
+	tests := []struct {
+		file       string
+		wantBounds image.Rectangle
+	}{
+		{"testdata/valid.png", image.Rect(0, 0, 32, 32)},
+		{"testdata/valid.jpg", image.Rect(0, 0, 32, 32)},
+		{"testdata/valid.gif", image.Rect(0, 0, 32, 32)},
+		{"testdata/valid.bmp", image.Rect(0, 0, 16, 12)},
+		{"testdata/valid.tiff", image.Rect(0, 0, 153, 55)},
+		{"testdata/valid.webp", image.Rect(0, 0, 150, 100)},
+	}
+	testReader := &imageReader{}
 
-	assert.NotNil(t, img)
-	assert.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			img, err := testReader.Read(tt.file)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBounds, img.Bounds())
+		})
+	}
 }
 
 func TestJpgOptimizer_OptimizeInaccessibleFolder(t *testing.T) {
@@ -83,6 +117,90 @@ func TestJpgOptimizer_OptimizeError(t *testing.T) {
 	assert.EqualError(t, err, "jpeg optimization error, jpeg: image is too large to encode")
 }
 
+func TestWebPOptimizer_Optimize(t *testing.T) {
+	img, err := (&imageReader{}).Read("testdata/valid.png")
+	require.NoError(t, err)
+
+	for _, lossless := range []bool{false, true} {
+		testOptimizer := &webpOptimizer{tmpFolder: "testdata", quality: 75, lossless: lossless}
+
+		f, err := testOptimizer.Optimize(img)
+		require.NoError(t, err)
+		defer func(name string) { _ = os.Remove(name) }(f)
+
+		file, err := os.Open(f)
+		require.NoError(t, err)
+		_, format, err := image.Decode(file)
+		_ = file.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "webp", format)
+	}
+}
+
+func TestWebPOptimizer_OptimizeError(t *testing.T) {
+	testOptimizer := &webpOptimizer{tmpFolder: "testdata", quality: 75}
+
+	f, err := testOptimizer.Optimize(image.NewGray(image.Rect(0, 0, 1<<15, 1)))
+	assert.Empty(t, f)
+	assert.EqualError(t, err, "webp optimization error, webp error, 32768x1 image is too large")
+
+	testOptimizer.tmpFolder = "doesnotexist"
+	f, err = testOptimizer.Optimize(mockImage)
+	assert.Empty(t, f)
+	assert.Regexp(t, "^webp error, .*no such file or directory$", err.Error())
+}
+
+func TestWebPOptimizer_OptimizeFallback(t *testing.T) {
+	testOptimizer := &webpOptimizer{tmpFolder: "testdata", lossless: true, fallback: &jpegOptimizer{tmpFolder: "testdata", quality: 30}}
+
+	f, err := testOptimizer.Optimize(image.NewGray(image.Rect(0, 0, 1, 1<<14+1)))
+	require.NoError(t, err)
+	defer func() { _ = os.Remove(f) }()
+
+	file, err := os.Open(f)
+	require.NoError(t, err)
+	defer file.Close()
+	decoded, format, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format, "tall captures do not fit in a webp")
+	assert.Equal(t, 1<<14+1, decoded.Height)
+}
+
+func TestPngOptimizer_Optimize(t *testing.T) {
+	img, err := (&imageReader{}).Read("testdata/valid.png")
+	require.NoError(t, err)
+
+	for _, dither := range []bool{false, true} {
+		testOptimizer := &pngOptimizer{tmpFolder: "testdata", colors: 16, dither: dither}
+
+		f, err := testOptimizer.Optimize(img)
+		require.NoError(t, err)
+		defer func(name string) { _ = os.Remove(name) }(f)
+
+		file, err := os.Open(f)
+		require.NoError(t, err)
+		decoded, format, err := image.Decode(file)
+		_ = file.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "png", format)
+		require.IsType(t, &image.Paletted{}, decoded)
+		assert.LessOrEqual(t, len(decoded.(*image.Paletted).Palette), 16)
+	}
+}
+
+func TestPngOptimizer_OptimizeError(t *testing.T) {
+	testOptimizer := &pngOptimizer{tmpFolder: "testdata", colors: 256}
+
+	f, err := testOptimizer.Optimize(image.NewGray(image.Rect(0, 0, 0, 1)))
+	assert.Empty(t, f)
+	assert.EqualError(t, err, "png optimization error, png: invalid format: invalid image size: 0x1")
+
+	testOptimizer.tmpFolder = "doesnotexist"
+	f, err = testOptimizer.Optimize(mockImage)
+	assert.Empty(t, f)
+	assert.Regexp(t, "^png error, .*no such file or directory$", err.Error())
+}
+
 func TestNewJpgPipeline(t *testing.T) {
 	p := newJpgPipeline(-99)
 
@@ -100,6 +218,15 @@ func (m *Mock) Read(path string) (image.Image, error) {
 	return mockImage, fmt.Errorf("read error")
 }
 
+func (m *Mock) Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "expected data" {
+		return nil, fmt.Errorf("decode error")
+	}
+
+	return mockImage, nil
+}
+
 func (m *Mock) Optimize(img image.Image) (string, error) {
 	if img == mockImage {
 		return "expected result", nil
@@ -128,6 +255,37 @@ func TestReaderOptimizer_RunReaderError(t *testing.T) {
 	assert.EqualError(t, err, "read error")
 }
 
+func TestReaderOptimizer_RunReader(t *testing.T) {
+	m := &Mock{}
+	ro := &readerOptimizer{reader: m, optimizer: m}
+
+	f, err := ro.RunReader(strings.NewReader("expected data"))
+	assert.Equal(t, "expected result", f)
+	assert.NoError(t, err)
+
+	f, err = ro.RunReader(strings.NewReader("wrong data"))
+	assert.Equal(t, "", f)
+	assert.EqualError(t, err, "decode error")
+}
+
+func TestImageReader_Decode(t *testing.T) {
+	testReader := &imageReader{}
+	data, err := os.ReadFile("testdata/valid.png")
+	assert.NoError(t, err)
+
+	img, err := testReader.Decode(bytes.NewReader(data))
+	assert.NotNil(t, img)
+	assert.NoError(t, err)
+
+	img, err = testReader.Decode(strings.NewReader("not a png"))
+	assert.Nil(t, img)
+	assert.EqualError(t, err, "image error, image: unknown format")
+
+	img, err = testReader.Decode(bytes.NewReader(data[:100]))
+	assert.Nil(t, img)
+	assert.EqualError(t, err, "png error, unexpected EOF", "the error names the detected format")
+}
+
 var mockImage = image.NewGray(image.Rect(0, 0, 1, 1))
 
 // TODO add benches with larger files to the repo
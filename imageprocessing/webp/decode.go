@@ -0,0 +1,52 @@
+package webp
+
+import (
+	"image"
+)
+
+// ConvertDecoded turns lossy images decoded by golang.org/x/image/webp into NRGBA images
+// VP8 stores limited range BT.601 colors, but image.YCbCr converts them as full range JPEG colors,
+// so white becomes light gray and colors lose saturation. Other images are returned as they are.
+func ConvertDecoded(img image.Image) image.Image {
+	var (
+		ycc   *image.YCbCr
+		alpha func(x, y int) uint8
+	)
+	switch m := img.(type) {
+	case *image.NYCbCrA:
+		ycc = &m.YCbCr
+		alpha = func(x, y int) uint8 { return m.A[m.AOffset(x, y)] }
+	case *image.YCbCr:
+		ycc = m
+		alpha = func(int, int) uint8 { return 0xff }
+	default:
+		return img
+	}
+
+	b := ycc.Rect
+	dst := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := dst.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			yy := int32(ycc.Y[ycc.YOffset(x, y)])
+			c := ycc.COffset(x, y)
+			u, v := int32(ycc.Cb[c]), int32(ycc.Cr[c])
+			dst.Pix[i+0], dst.Pix[i+1], dst.Pix[i+2] = toRGB(yy, u, v)
+			dst.Pix[i+3] = alpha(x, y)
+			i += 4
+		}
+	}
+
+	return dst
+}
+
+// toRGB is the fixed point conversion of libwebp, the inverse of toYUV
+func toRGB(y, u, v int32) (uint8, uint8, uint8) {
+	multHi := func(v, coeff int32) int32 { return (v * coeff) >> 8 }
+	clip := func(v int32) uint8 { return clip8(v >> 6) }
+	luma := multHi(y, 19077)
+
+	return clip(luma + multHi(v, 26149) - 14234),
+		clip(luma - multHi(u, 6419) - multHi(v, 13320) + 8708),
+		clip(luma + multHi(u, 33050) - 17685)
+}
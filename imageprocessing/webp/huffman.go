@@ -0,0 +1,307 @@
+package webp
+
+import "sort"
+
+const (
+	// maxCodeLength is the longest Huffman code VP8L decoders accept
+	maxCodeLength = 15
+	// maxCodeLengthCodeLength is the longest code of the alphabet that compresses code lengths
+	maxCodeLengthCodeLength = 7
+)
+
+// codeLengthCodeOrder is the order code lengths of the code length alphabet are stored in
+var codeLengthCodeOrder = [19]uint8{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter packs bits starting from the least significant one as VP8L requires
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nBits -= 8
+	}
+}
+
+// bytes flushes the remaining bits padded with zeros
+func (w *bitWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nBits = 0, 0
+	}
+
+	return w.buf
+}
+
+// huffmanCode has bit reversed canonical codes, so they can be written as they are
+// Symbols of single symbol codes take no bits.
+type huffmanCode struct {
+	lengths []uint32
+	codes   []uint32
+}
+
+func (w *bitWriter) writeSymbol(c huffmanCode, symbol int) {
+	w.writeBits(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writeHuffmanCode stores the code for the histogram and returns it
+func (w *bitWriter) writeHuffmanCode(histogram []uint32) huffmanCode {
+	var symbols []int
+	for s, count := range histogram {
+		if count > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	// an unused code still needs a symbol
+	if len(symbols) == 0 {
+		symbols = []int{0}
+	}
+
+	code := huffmanCode{lengths: make([]uint32, len(histogram)), codes: make([]uint32, len(histogram))}
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		w.writeSimpleCode(symbols)
+		if len(symbols) == 2 {
+			code.lengths[symbols[0]], code.lengths[symbols[1]] = 1, 1
+			code.codes[symbols[1]] = 1
+		}
+
+		return code
+	}
+
+	if len(symbols) == 1 {
+		// the length only has to be non-zero, decoders read no bits for the symbol
+		lengths := make([]uint32, len(histogram))
+		lengths[symbols[0]] = 1
+		w.writeCodeLengths(lengths)
+
+		return code
+	}
+
+	lengths := huffmanLengths(histogram, maxCodeLength)
+	w.writeCodeLengths(lengths)
+
+	return canonicalCode(lengths)
+}
+
+// writeSimpleCode stores one or two symbols below 256 without code lengths
+func (w *bitWriter) writeSimpleCode(symbols []int) {
+	w.writeBits(1, 1)
+	w.writeBits(uint32(len(symbols)-1), 1)
+	if symbols[0] < 2 {
+		w.writeBits(0, 1)
+		w.writeBits(uint32(symbols[0]), 1)
+	} else {
+		w.writeBits(1, 1)
+		w.writeBits(uint32(symbols[0]), 8)
+	}
+	if len(symbols) == 2 {
+		w.writeBits(uint32(symbols[1]), 8)
+	}
+}
+
+// codeLengthToken is a code length or a repeat code 16, 17 or 18 with its extra bits
+type codeLengthToken struct {
+	symbol int
+	extra  uint32
+}
+
+// writeCodeLengths stores lengths of a normal code, runs are replaced by repeat codes
+func (w *bitWriter) writeCodeLengths(lengths []uint32) {
+	tokens := codeLengthTokens(lengths)
+	histogram := make([]uint32, len(codeLengthCodeOrder))
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+
+	var clCode huffmanCode
+	clLengths := make([]uint32, len(histogram))
+	used := 0
+	for s, count := range histogram {
+		if count > 0 {
+			used++
+			clLengths[s] = 1
+		}
+	}
+	if used > 1 {
+		clLengths = huffmanLengths(histogram, maxCodeLengthCodeLength)
+		clCode = canonicalCode(clLengths)
+	} else {
+		clCode = huffmanCode{lengths: make([]uint32, len(histogram)), codes: make([]uint32, len(histogram))}
+	}
+
+	n := len(codeLengthCodeOrder)
+	for n > 4 && clLengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+	w.writeBits(0, 1)
+	w.writeBits(uint32(n-4), 4)
+	for _, s := range codeLengthCodeOrder[:n] {
+		w.writeBits(clLengths[s], 3)
+	}
+	// all lengths are stored, max_symbol is not used
+	w.writeBits(0, 1)
+
+	extraBits := map[int]uint{16: 2, 17: 3, 18: 7}
+	for _, t := range tokens {
+		w.writeSymbol(clCode, t.symbol)
+		if t.symbol >= 16 {
+			w.writeBits(t.extra, extraBits[t.symbol])
+		}
+	}
+}
+
+func codeLengthTokens(lengths []uint32) []codeLengthToken {
+	var tokens []codeLengthToken
+	for i := 0; i < len(lengths); {
+		v := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == v {
+			run++
+		}
+		i += run
+
+		if v == 0 {
+			for run > 0 {
+				switch {
+				case run < 3:
+					tokens = append(tokens, codeLengthToken{symbol: 0})
+					run--
+				case run <= 10:
+					tokens = append(tokens, codeLengthToken{symbol: 17, extra: uint32(run - 3)})
+					run = 0
+				default:
+					n := min(run, 138)
+					tokens = append(tokens, codeLengthToken{symbol: 18, extra: uint32(n - 11)})
+					run -= n
+				}
+			}
+
+			continue
+		}
+
+		// code 16 repeats the previous length, so it is written once first
+		tokens = append(tokens, codeLengthToken{symbol: int(v)})
+		run--
+		for run >= 3 {
+			n := min(run, 6)
+			tokens = append(tokens, codeLengthToken{symbol: 16, extra: uint32(n - 3)})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{symbol: int(v)})
+		}
+	}
+
+	return tokens
+}
+
+// huffmanLengths returns code lengths no longer than maxLength for a histogram with at least two symbols
+// Rare symbols are made more frequent until the code fits.
+func huffmanLengths(histogram []uint32, maxLength uint32) []uint32 {
+	for minCount := uint32(1); ; minCount *= 2 {
+		lengths := buildLengths(histogram, minCount)
+		fits := true
+		for _, l := range lengths {
+			if l > maxLength {
+				fits = false
+
+				break
+			}
+		}
+		if fits {
+			return lengths
+		}
+	}
+}
+
+func buildLengths(histogram []uint32, minCount uint32) []uint32 {
+	type node struct {
+		count  uint32
+		parent int
+		symbol int
+	}
+
+	var nodes []node
+	for s, count := range histogram {
+		if count > 0 {
+			nodes = append(nodes, node{count: max(count, minCount), symbol: s})
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].count < nodes[j].count
+	})
+
+	// leaves and merged nodes are both sorted by count, so the smallest node is at the head of one of them
+	nLeaves := len(nodes)
+	leaf, merged := 0, nLeaves
+	smallest := func() int {
+		if leaf < nLeaves && (merged >= len(nodes) || nodes[leaf].count <= nodes[merged].count) {
+			leaf++
+
+			return leaf - 1
+		}
+		merged++
+
+		return merged - 1
+	}
+	for len(nodes) < 2*nLeaves-1 {
+		a, b := smallest(), smallest()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, parent: -1})
+		nodes[a].parent, nodes[b].parent = len(nodes)-1, len(nodes)-1
+	}
+
+	// parents always come after their children
+	depth := make([]uint32, len(nodes))
+	for i := len(nodes) - 2; i >= 0; i-- {
+		depth[i] = depth[nodes[i].parent] + 1
+	}
+	lengths := make([]uint32, len(histogram))
+	for i := 0; i < nLeaves; i++ {
+		lengths[nodes[i].symbol] = depth[i]
+	}
+
+	return lengths
+}
+
+// canonicalCode assigns codes to lengths the same way decoders do
+func canonicalCode(lengths []uint32) huffmanCode {
+	var count [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+
+	var next [maxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+
+	c := huffmanCode{lengths: lengths, codes: make([]uint32, len(lengths))}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[s] = reverseBits(next[l], l)
+		next[l]++
+	}
+
+	return c
+}
+
+func reverseBits(v, n uint32) uint32 {
+	r := uint32(0)
+	for i := uint32(0); i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+
+	return r
+}
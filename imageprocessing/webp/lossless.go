@@ -0,0 +1,434 @@
+package webp
+
+import (
+	"image"
+	"math/bits"
+)
+
+const (
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// predictorBits sets 16x16 tiles sharing a predictor
+	predictorBits = 4
+	// colorCacheBits sets a cache of 1024 recent colors
+	colorCacheBits = 10
+
+	nLiteralCodes  = 256
+	nLengthCodes   = 24
+	nDistanceCodes = 40
+
+	hashBits = 16
+	// maxChain limits how many earlier positions are tried for every pixel
+	maxChain = 32
+	// minMatch is the shortest backward reference, shorter ones cost more than literals
+	minMatch    = 3
+	maxMatch    = 4096
+	maxDistance = 1<<20 - 120
+)
+
+// predictorModes are tried for every tile, they are L, T, Average2(L, T), Select and ClampAddSubtractFull
+var predictorModes = []uint32{1, 2, 7, 11, 12}
+
+// encodeLossless returns a VP8L bitstream with its header
+func encodeLossless(img *image.NRGBA) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	argb := make([]uint32, w*h)
+	alpha := uint32(0)
+	for i := range argb {
+		p := img.Pix[4*i : 4*i+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		if p[3] != 0xff {
+			alpha = 1
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.writeBits(0x2f, 8)
+	bw.writeBits(uint32(w-1), 14)
+	bw.writeBits(uint32(h-1), 14)
+	bw.writeBits(alpha, 1)
+	bw.writeBits(0, 3)
+	encodeImage(bw, argb, w, h, true)
+
+	return bw.bytes()
+}
+
+// encodeAlpha returns the ALPH chunk of lossy images, alpha values are stored as green of a VP8L image
+func encodeAlpha(img *image.NRGBA) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	argb := make([]uint32, w*h)
+	for i := range argb {
+		argb[i] = uint32(img.Pix[4*i+3]) << 8
+	}
+
+	bw := &bitWriter{}
+	encodeImage(bw, argb, w, h, false)
+
+	// lossless compression without filtering
+	return append([]byte{1}, bw.bytes()...)
+}
+
+// encodeImage writes transforms and the transformed pixels of a VP8L image without its header
+func encodeImage(bw *bitWriter, argb []uint32, w, h int, subtractGreen bool) {
+	if subtractGreen {
+		bw.writeBits(1, 1)
+		bw.writeBits(transformSubtractGreen, 2)
+		for i, p := range argb {
+			g := p >> 8 & 0xff
+			r := (p>>16 - g) & 0xff
+			b := (p - g) & 0xff
+			argb[i] = p&0xff00ff00 | r<<16 | b
+		}
+	}
+
+	modes, residuals := predict(argb, w, h)
+	bw.writeBits(1, 1)
+	bw.writeBits(transformPredictor, 2)
+	bw.writeBits(predictorBits-2, 3)
+	encodePixels(bw, modes, tiles(w), tiles(h), false)
+
+	bw.writeBits(0, 1)
+	encodePixels(bw, residuals, w, h, true)
+}
+
+func tiles(size int) int {
+	return (size + 1<<predictorBits - 1) >> predictorBits
+}
+
+// predict chooses the predictor with the smallest residuals for every tile
+// It returns the predictor image with modes in green and residuals of all pixels.
+func predict(argb []uint32, w, h int) ([]uint32, []uint32) {
+	tw, th := tiles(w), tiles(h)
+	modes := make([]uint32, tw*th)
+	residuals := make([]uint32, len(argb))
+	for ty := 0; ty < th; ty++ {
+		for tx := 0; tx < tw; tx++ {
+			best, bestCost := predictorModes[0], -1
+			for _, mode := range predictorModes {
+				cost := 0
+				forTile(tx, ty, w, h, func(x, y int) {
+					cost += residualCost(argb[y*w+x], predictPixel(argb, w, x, y, mode))
+				})
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[ty*tw+tx] = best << 8
+			forTile(tx, ty, w, h, func(x, y int) {
+				residuals[y*w+x] = subPixels(argb[y*w+x], predictPixel(argb, w, x, y, best))
+			})
+		}
+	}
+
+	return modes, residuals
+}
+
+func forTile(tx, ty, w, h int, f func(x, y int)) {
+	size := 1 << predictorBits
+	for y := ty * size; y < min((ty+1)*size, h); y++ {
+		for x := tx * size; x < min((tx+1)*size, w); x++ {
+			f(x, y)
+		}
+	}
+}
+
+// predictPixel mirrors decoders, the first row always uses L and the first column uses T
+func predictPixel(argb []uint32, w, x, y int, mode uint32) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		mode = 1
+	case x == 0:
+		mode = 2
+	}
+
+	i := y*w + x
+	switch mode {
+	case 1:
+		return argb[i-1]
+	case 2:
+		return argb[i-w]
+	case 7:
+		return mapChannels(argb[i-1], argb[i-w], 0, func(l, t, _ int32) int32 {
+			return (l + t) / 2
+		})
+	case 11:
+		l, t, tl := argb[i-1], argb[i-w], argb[i-w-1]
+		if manhattan(tl, t) < manhattan(tl, l) {
+			return l
+		}
+
+		return t
+	default:
+		return mapChannels(argb[i-1], argb[i-w], argb[i-w-1], func(l, t, tl int32) int32 {
+			return min(max(l+t-tl, 0), 255)
+		})
+	}
+}
+
+func mapChannels(a, b, c uint32, f func(a, b, c int32) int32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := f(int32(a>>shift&0xff), int32(b>>shift&0xff), int32(c>>shift&0xff))
+		p |= uint32(v) << shift
+	}
+
+	return p
+}
+
+func manhattan(a, b uint32) int32 {
+	var d int32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int32(a>>shift&0xff) - int32(b>>shift&0xff)
+		d += max(v, -v)
+	}
+
+	return d
+}
+
+// subPixels subtracts every channel modulo 256
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		p |= (a>>shift - b>>shift) & 0xff << shift
+	}
+
+	return p
+}
+
+// residualCost favors residuals close to zero, they get the shortest codes
+func residualCost(p, prediction uint32) int {
+	r := subPixels(p, prediction)
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(int8(r >> shift))
+		cost += max(v, -v)
+	}
+
+	return cost
+}
+
+// token is a literal pixel, a color cache index or a backward reference
+type token struct {
+	kind   int
+	value  uint32
+	length int
+}
+
+const (
+	literalToken = iota
+	cacheToken
+	copyToken
+)
+
+// encodePixels writes entropy coded pixels, sub-images are not top level and have no meta codes
+func encodePixels(bw *bitWriter, argb []uint32, w, h int, topLevel bool) {
+	cacheBits := 0
+	if topLevel {
+		cacheBits = colorCacheBits
+	}
+	tokens := backwardReferences(argb, w, cacheBits)
+
+	greenSize := nLiteralCodes + nLengthCodes
+	if cacheBits > 0 {
+		greenSize += 1 << cacheBits
+	}
+	histograms := [5][]uint32{
+		make([]uint32, greenSize),
+		make([]uint32, 256),
+		make([]uint32, 256),
+		make([]uint32, 256),
+		make([]uint32, nDistanceCodes),
+	}
+	for _, t := range tokens {
+		switch t.kind {
+		case literalToken:
+			histograms[0][t.value>>8&0xff]++
+			histograms[1][t.value>>16&0xff]++
+			histograms[2][t.value&0xff]++
+			histograms[3][t.value>>24]++
+		case cacheToken:
+			histograms[0][nLiteralCodes+nLengthCodes+int(t.value)]++
+		case copyToken:
+			lengthCode, _, _ := prefixEncode(t.length)
+			distCode, _, _ := prefixEncode(int(t.value))
+			histograms[0][nLiteralCodes+lengthCode]++
+			histograms[4][distCode]++
+		}
+	}
+
+	if cacheBits > 0 {
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(cacheBits), 4)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	if topLevel {
+		// a single group of codes for the whole image
+		bw.writeBits(0, 1)
+	}
+	var codes [5]huffmanCode
+	for i, histogram := range histograms {
+		codes[i] = bw.writeHuffmanCode(histogram)
+	}
+
+	for _, t := range tokens {
+		switch t.kind {
+		case literalToken:
+			bw.writeSymbol(codes[0], int(t.value>>8&0xff))
+			bw.writeSymbol(codes[1], int(t.value>>16&0xff))
+			bw.writeSymbol(codes[2], int(t.value&0xff))
+			bw.writeSymbol(codes[3], int(t.value>>24))
+		case cacheToken:
+			bw.writeSymbol(codes[0], nLiteralCodes+nLengthCodes+int(t.value))
+		case copyToken:
+			code, n, extra := prefixEncode(t.length)
+			bw.writeSymbol(codes[0], nLiteralCodes+code)
+			bw.writeBits(extra, n)
+			code, n, extra = prefixEncode(int(t.value))
+			bw.writeSymbol(codes[4], code)
+			bw.writeBits(extra, n)
+		}
+	}
+}
+
+// prefixEncode splits lengths and distance codes into a prefix symbol and extra bits
+func prefixEncode(v int) (int, uint, uint32) {
+	n := uint32(v - 1)
+	if n < 4 {
+		return int(n), 0, 0
+	}
+	h := uint(bits.Len32(n) - 1)
+	second := n >> (h - 1) & 1
+
+	return int(2*h + uint(second)), h - 1, n & (1<<(h-1) - 1)
+}
+
+// backwardReferences finds repeated pixels with hash chains, other pixels are looked up in the color cache
+func backwardReferences(argb []uint32, w, cacheBits int) []token {
+	distanceCodes := planeCodes(w)
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(argb))
+	insert := func(i int) {
+		if i+1 >= len(argb) {
+			return
+		}
+		k := pairHash(argb[i], argb[i+1])
+		prev[i] = head[k]
+		head[k] = int32(i)
+	}
+
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+
+	var tokens []token
+	for i := 0; i < len(argb); {
+		length, distance := 0, 0
+		try := func(d int) {
+			if d < 1 || d > i || d > maxDistance {
+				return
+			}
+			l := matchLength(argb, i, d)
+			if l > length || l == length && distanceCode(distanceCodes, d) < distanceCode(distanceCodes, distance) {
+				length, distance = l, d
+			}
+		}
+		// left and top neighbours have the cheapest distance codes
+		try(1)
+		try(w)
+		if i+1 < len(argb) {
+			k := pairHash(argb[i], argb[i+1])
+			for j, n := head[k], 0; j >= 0 && n < maxChain; j, n = prev[j], n+1 {
+				try(i - int(j))
+			}
+		}
+
+		n := 1
+		switch {
+		case length >= minMatch:
+			tokens = append(tokens, token{kind: copyToken, value: uint32(distanceCode(distanceCodes, distance)), length: length})
+			n = length
+		case cache != nil && cache[cacheIndex(argb[i], cacheBits)] == argb[i]:
+			tokens = append(tokens, token{kind: cacheToken, value: cacheIndex(argb[i], cacheBits)})
+		default:
+			tokens = append(tokens, token{kind: literalToken, value: argb[i]})
+		}
+
+		for end := i + n; i < end; i++ {
+			insert(i)
+			if cache != nil {
+				cache[cacheIndex(argb[i], cacheBits)] = argb[i]
+			}
+		}
+	}
+
+	return tokens
+}
+
+func matchLength(argb []uint32, i, d int) int {
+	l := 0
+	for i+l < len(argb) && l < maxMatch && argb[i+l] == argb[i+l-d] {
+		l++
+	}
+
+	return l
+}
+
+func pairHash(a, b uint32) uint32 {
+	return (a*0x1e35a7bd ^ b*0x9e3779b1) >> (32 - hashBits)
+}
+
+func cacheIndex(argb uint32, cacheBits int) uint32 {
+	return argb * 0x1e35a7bd >> (32 - cacheBits)
+}
+
+// planeCodes maps short distances to the 120 codes of nearby pixels, the rest use distance+120
+func planeCodes(w int) map[int]int {
+	codes := make(map[int]int, len(distanceMapTable))
+	for i, c := range distanceMapTable {
+		d := int(c>>4)*w + 8 - int(c&0xf)
+		if d < 1 {
+			d = 1
+		}
+		if _, ok := codes[d]; !ok {
+			codes[d] = i + 1
+		}
+	}
+
+	return codes
+}
+
+func distanceCode(codes map[int]int, d int) int {
+	if d == 0 {
+		return 1 << 30
+	}
+	if c, ok := codes[d]; ok {
+		return c
+	}
+
+	return d + len(distanceMapTable)
+}
+
+// distanceMapTable lists offsets of nearby pixels, the row is in the high nibble and 8-column in the low one
+var distanceMapTable = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
@@ -0,0 +1,732 @@
+package webp
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+)
+
+// Intra prediction modes of 16x16 luma and 8x8 chroma blocks
+const (
+	predDC = iota
+	predTM
+	predVE
+	predHE
+	nPred
+)
+
+const (
+	uniformProb = 128
+	// maxLevel is the largest quantized coefficient the token alphabet can express
+	maxLevel = 2048
+	// rounding of quantized coefficients out of 256, AC coefficients are rounded down a bit more
+	dcBias = 128
+	acBias = 108
+)
+
+// quantizer has DC and AC step sizes of a frame
+type quantizer struct {
+	y1, y2, uv [2]int32
+}
+
+// newQuantizer computes step sizes the same way decoders do
+func newQuantizer(q int) quantizer {
+	var z quantizer
+	z.y1 = [2]int32{int32(dequantTableDC[q]), int32(dequantTableAC[q])}
+	z.y2 = [2]int32{int32(dequantTableDC[q]) * 2, int32(dequantTableAC[q]) * 155 / 100}
+	if z.y2[1] < 8 {
+		z.y2[1] = 8
+	}
+	z.uv = [2]int32{int32(dequantTableDC[min(q, 117)]), int32(dequantTableAC[q])}
+
+	return z
+}
+
+// quantizerIndex maps quality to a quantizer index from 0 (best) to 127, with the curve libwebp uses
+func quantizerIndex(quality int) int {
+	c := float64(quality) / 100
+	if c < 0.75 {
+		c *= 2.0 / 3
+	} else {
+		c = 2*c - 1
+	}
+
+	return int(math.Round(127 * (1 - math.Cbrt(c))))
+}
+
+// plane is an 8-bit image channel padded to whole macroblocks
+type plane struct {
+	pix    []uint8
+	stride int
+}
+
+func (p plane) at(x, y int) uint8 {
+	return p.pix[y*p.stride+x]
+}
+
+// mbContext has flags of non-zero coefficients of neighbouring blocks, they select token probabilities
+// nz holds 4 luma flags and 2 flags of each chroma plane.
+type mbContext struct {
+	nzY16 uint8
+	nz    [8]uint8
+}
+
+// mbHeader is what the first partition stores about a macroblock
+type mbHeader struct {
+	skip          bool
+	yMode, uvMode int
+}
+
+type lossyEncoder struct {
+	mbw, mbh     int
+	q            int
+	quant        quantizer
+	src, rec     [3]plane
+	headers      []mbHeader
+	tokens       *boolEncoder
+	left         mbContext
+	up           []mbContext
+	skippedCount int
+}
+
+// encodeLossy returns a VP8 key frame, macroblocks use 16x16 luma and 8x8 chroma prediction
+func encodeLossy(img *image.NRGBA, quality int) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	e := &lossyEncoder{
+		mbw:    (w + 15) / 16,
+		mbh:    (h + 15) / 16,
+		q:      quantizerIndex(quality),
+		tokens: newBoolEncoder(),
+	}
+	e.quant = newQuantizer(e.q)
+	e.src = toYUV(img, e.mbw, e.mbh)
+	for i, p := range e.src {
+		e.rec[i] = plane{pix: make([]uint8, len(p.pix)), stride: p.stride}
+	}
+	e.up = make([]mbContext, e.mbw)
+	e.headers = make([]mbHeader, 0, e.mbw*e.mbh)
+
+	for mby := 0; mby < e.mbh; mby++ {
+		e.left = mbContext{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+
+	first := e.firstPartition()
+	frame := make([]byte, 0, 10+len(first)+len(e.tokens.buf))
+	// key frame, version 0, shown, followed by the size of the first partition
+	tag := uint32(1<<4 | len(first)<<5)
+	frame = append(frame, byte(tag), byte(tag>>8), byte(tag>>16))
+	frame = append(frame, 0x9d, 0x01, 0x2a)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(w))
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(h))
+	frame = append(frame, first...)
+
+	return append(frame, e.tokens.flush()...)
+}
+
+// toYUV converts colors with BT.601 coefficients used by VP8, chroma is averaged over 2x2 pixels
+// Edge pixels are repeated to fill whole macroblocks.
+func toYUV(img *image.NRGBA, mbw, mbh int) [3]plane {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	yp := plane{pix: make([]uint8, 256*mbw*mbh), stride: 16 * mbw}
+	up := plane{pix: make([]uint8, 64*mbw*mbh), stride: 8 * mbw}
+	vp := plane{pix: make([]uint8, 64*mbw*mbh), stride: 8 * mbw}
+
+	rgb := func(x, y int) (int32, int32, int32) {
+		i := 4 * (min(y, h-1)*w + min(x, w-1))
+		return int32(img.Pix[i]), int32(img.Pix[i+1]), int32(img.Pix[i+2])
+	}
+	for y := 0; y < 16*mbh; y++ {
+		for x := 0; x < 16*mbw; x++ {
+			r, g, b := rgb(x, y)
+			yp.pix[y*yp.stride+x] = uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+		}
+	}
+	for y := 0; y < 8*mbh; y++ {
+		for x := 0; x < 8*mbw; x++ {
+			var r, g, b int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			// sums of 4 pixels are scaled by 2 more bits
+			const rounding = 128<<18 + 1<<17
+			up.pix[y*up.stride+x] = clip8((-9719*r - 19081*g + 28800*b + rounding) >> 18)
+			vp.pix[y*vp.stride+x] = clip8((28800*r - 24116*g - 4684*b + rounding) >> 18)
+		}
+	}
+
+	return [3]plane{yp, up, vp}
+}
+
+// encodeMacroblock predicts, transforms and quantizes the macroblock, its tokens are written right away
+func (e *lossyEncoder) encodeMacroblock(mbx, mby int) {
+	var (
+		header  mbHeader
+		y2      [16]int32
+		yLevels [16][16]int32
+		uv      [2][4][16]int32
+	)
+
+	header.yMode = e.bestMode([]int{0}, mbx, mby, 16)
+	header.uvMode = e.bestMode([]int{1, 2}, mbx, mby, 8)
+	nonZero := e.encodeLuma(mbx, mby, header.yMode, &y2, &yLevels)
+	for c := 0; c < 2; c++ {
+		if e.encodeChroma(c+1, mbx, mby, header.uvMode, &uv[c]) {
+			nonZero = true
+		}
+	}
+
+	header.skip = !nonZero
+	e.headers = append(e.headers, header)
+	if header.skip {
+		e.skippedCount++
+		e.left, e.up[mbx] = mbContext{}, mbContext{}
+
+		return
+	}
+
+	left, up := &e.left, &e.up[mbx]
+	nz := e.tokens.putCoefficients(planeY2, &y2, 0, left.nzY16+up.nzY16)
+	left.nzY16, up.nzY16 = nz, nz
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			nz := e.tokens.putCoefficients(planeY1WithY2, &yLevels[4*y+x], 1, left.nz[y]+up.nz[x])
+			left.nz[y], up.nz[x] = nz, nz
+		}
+	}
+	for c := 0; c < 2; c++ {
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 2; x++ {
+				l, u := &left.nz[4+2*c+y], &up.nz[4+2*c+x]
+				nz := e.tokens.putCoefficients(planeUV, &uv[c][2*y+x], 0, *l+*u)
+				*l, *u = nz, nz
+			}
+		}
+	}
+}
+
+// bestMode picks the prediction closest to the source, chroma modes are chosen for both planes
+func (e *lossyEncoder) bestMode(planes []int, mbx, mby, size int) int {
+	best, bestErr := predDC, int64(-1)
+	for mode := 0; mode < nPred; mode++ {
+		var sse int64
+		for _, c := range planes {
+			pred := e.predict(c, mbx, mby, size, mode)
+			x0, y0 := mbx*size, mby*size
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					d := int64(e.src[c].at(x0+x, y0+y)) - int64(pred[y*size+x])
+					sse += d * d
+				}
+			}
+		}
+		if bestErr < 0 || sse < bestErr {
+			best, bestErr = mode, sse
+		}
+	}
+
+	return best
+}
+
+// predict returns the size x size prediction from reconstructed neighbours
+// Missing neighbours are replaced with 127 above and 129 on the left, as decoders do.
+func (e *lossyEncoder) predict(c, mbx, mby, size, mode int) []uint8 {
+	rec := e.rec[c]
+	x0, y0 := mbx*size, mby*size
+	top := make([]int32, size)
+	left := make([]int32, size)
+	corner := int32(0x81)
+	for i := 0; i < size; i++ {
+		top[i], left[i] = 0x7f, 0x81
+		if mby > 0 {
+			top[i] = int32(rec.at(x0+i, y0-1))
+		}
+		if mbx > 0 {
+			left[i] = int32(rec.at(x0-1, y0+i))
+		}
+	}
+	switch {
+	case mby == 0:
+		corner = 0x7f
+	case mbx > 0:
+		corner = int32(rec.at(x0-1, y0-1))
+	}
+
+	pred := make([]uint8, size*size)
+	switch mode {
+	case predDC:
+		shift := 3
+		if size == 16 {
+			shift = 4
+		}
+		var sum int32
+		switch {
+		case mbx > 0 && mby > 0:
+			for i := 0; i < size; i++ {
+				sum += top[i] + left[i]
+			}
+			sum = (sum + int32(size)) >> (shift + 1)
+		case mby > 0:
+			for i := 0; i < size; i++ {
+				sum += top[i]
+			}
+			sum = (sum + int32(size/2)) >> shift
+		case mbx > 0:
+			for i := 0; i < size; i++ {
+				sum += left[i]
+			}
+			sum = (sum + int32(size/2)) >> shift
+		default:
+			sum = 0x80
+		}
+		for i := range pred {
+			pred[i] = uint8(sum)
+		}
+	case predTM:
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				pred[y*size+x] = clip8(left[y] + top[x] - corner)
+			}
+		}
+	case predVE:
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				pred[y*size+x] = uint8(top[x])
+			}
+		}
+	case predHE:
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				pred[y*size+x] = uint8(left[y])
+			}
+		}
+	}
+
+	return pred
+}
+
+// encodeLuma quantizes the macroblock with DC coefficients in the Y2 block and reconstructs it
+func (e *lossyEncoder) encodeLuma(mbx, mby, mode int, y2 *[16]int32, levels *[16][16]int32) bool {
+	pred := e.predict(0, mbx, mby, 16, mode)
+	src, rec := e.src[0], e.rec[0]
+	x0, y0 := 16*mbx, 16*mby
+
+	var coeffs [16][16]int32
+	var dc [16]int32
+	for n := 0; n < 16; n++ {
+		bx, by := 4*(n%4), 4*(n/4)
+		var residual [16]int32
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				residual[4*y+x] = int32(src.at(x0+bx+x, y0+by+y)) - int32(pred[(by+y)*16+bx+x])
+			}
+		}
+		coeffs[n] = forwardDCT(&residual)
+		dc[n] = coeffs[n][0]
+	}
+
+	nonZero := false
+	wht := forwardWHT(&dc)
+	var dequantized [16]int32
+	for i, c := range wht {
+		y2[i] = quantize(c, e.quant.y2[min(i, 1)], i == 0)
+		dequantized[i] = y2[i] * e.quant.y2[min(i, 1)]
+		nonZero = nonZero || y2[i] != 0
+	}
+	dcs := inverseWHT(&dequantized)
+
+	for n := 0; n < 16; n++ {
+		bx, by := 4*(n%4), 4*(n/4)
+		block := [16]int32{dcs[n]}
+		for i := 1; i < 16; i++ {
+			levels[n][i] = quantize(coeffs[n][i], e.quant.y1[1], false)
+			block[i] = levels[n][i] * e.quant.y1[1]
+			nonZero = nonZero || levels[n][i] != 0
+		}
+		for y := 0; y < 4; y++ {
+			copy(rec.pix[(y0+by+y)*rec.stride+x0+bx:], pred[(by+y)*16+bx:(by+y)*16+bx+4])
+		}
+		inverseDCT(rec.pix[(y0+by)*rec.stride+x0+bx:], rec.stride, &block)
+	}
+
+	return nonZero
+}
+
+// encodeChroma quantizes the 8x8 block of the chroma plane c and reconstructs it
+func (e *lossyEncoder) encodeChroma(c, mbx, mby, mode int, levels *[4][16]int32) bool {
+	pred := e.predict(c, mbx, mby, 8, mode)
+	src, rec := e.src[c], e.rec[c]
+	x0, y0 := 8*mbx, 8*mby
+
+	nonZero := false
+	for n := 0; n < 4; n++ {
+		bx, by := 4*(n%2), 4*(n/2)
+		var residual [16]int32
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				residual[4*y+x] = int32(src.at(x0+bx+x, y0+by+y)) - int32(pred[(by+y)*8+bx+x])
+			}
+		}
+		coeffs := forwardDCT(&residual)
+
+		var block [16]int32
+		for i, coeff := range coeffs {
+			levels[n][i] = quantize(coeff, e.quant.uv[min(i, 1)], i == 0)
+			block[i] = levels[n][i] * e.quant.uv[min(i, 1)]
+			nonZero = nonZero || levels[n][i] != 0
+		}
+		for y := 0; y < 4; y++ {
+			copy(rec.pix[(y0+by+y)*rec.stride+x0+bx:], pred[(by+y)*8+bx:(by+y)*8+bx+4])
+		}
+		inverseDCT(rec.pix[(y0+by)*rec.stride+x0+bx:], rec.stride, &block)
+	}
+
+	return nonZero
+}
+
+func quantize(c, step int32, dc bool) int32 {
+	bias := int32(acBias)
+	if dc {
+		bias = dcBias
+	}
+	level := min((max(c, -c)+step*bias>>8)/step, maxLevel)
+	if c < 0 {
+		return -level
+	}
+
+	return level
+}
+
+// firstPartition has the frame header and modes of all macroblocks
+func (e *lossyEncoder) firstPartition() []byte {
+	b := newBoolEncoder()
+	// color space and clamping type
+	b.putBit(uniformProb, false)
+	b.putBit(uniformProb, false)
+	// no segmentation
+	b.putBit(uniformProb, false)
+	// normal loop filter with the level growing with the quantizer, no sharpness and no deltas
+	b.putBit(uniformProb, false)
+	b.putUint(uint32(e.q*3/8), 6)
+	b.putUint(0, 3)
+	b.putBit(uniformProb, false)
+	// a single token partition
+	b.putUint(0, 2)
+	// the base quantizer without deltas
+	b.putUint(uint32(e.q), 7)
+	for i := 0; i < 5; i++ {
+		b.putBit(uniformProb, false)
+	}
+	// refresh entropy probabilities
+	b.putBit(uniformProb, false)
+	// default token probabilities are kept
+	for i := range tokenProbUpdateProb {
+		for j := range tokenProbUpdateProb[i] {
+			for k := range tokenProbUpdateProb[i][j] {
+				for _, p := range tokenProbUpdateProb[i][j][k] {
+					b.putBit(p, false)
+				}
+			}
+		}
+	}
+
+	total := len(e.headers)
+	skipProb := uint8(min(max((total-e.skippedCount)*255/total, 1), 254))
+	b.putBit(uniformProb, true)
+	b.putUint(uint32(skipProb), 8)
+
+	for _, h := range e.headers {
+		b.putBit(skipProb, h.skip)
+		// 16x16 luma prediction
+		b.putBit(145, true)
+		switch h.yMode {
+		case predDC, predVE:
+			b.putBit(156, false)
+			b.putBit(163, h.yMode == predVE)
+		default:
+			b.putBit(156, true)
+			b.putBit(128, h.yMode == predTM)
+		}
+		b.putBit(142, h.uvMode != predDC)
+		if h.uvMode != predDC {
+			b.putBit(114, h.uvMode != predVE)
+			if h.uvMode != predVE {
+				b.putBit(183, h.uvMode == predTM)
+			}
+		}
+	}
+
+	return b.flush()
+}
+
+// putCoefficients writes tokens of the block in zigzag order and returns 1 if any of them is not zero
+func (e *boolEncoder) putCoefficients(p int, levels *[16]int32, first int, ctx uint8) uint8 {
+	probs := &defaultTokenProb[p]
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[zigzag[n]] != 0 {
+			last = n
+		}
+	}
+
+	prob := &probs[bands[first]][ctx]
+	e.putBit(prob[0], last >= 0)
+	if last < 0 {
+		return 0
+	}
+
+	for n := first; n <= last; n++ {
+		v := levels[zigzag[n]]
+		if v == 0 {
+			e.putBit(prob[1], false)
+			prob = &probs[bands[n+1]][0]
+
+			continue
+		}
+
+		e.putBit(prob[1], true)
+		e.putLevel(prob, max(v, -v))
+		if max(v, -v) == 1 {
+			prob = &probs[bands[n+1]][1]
+		} else {
+			prob = &probs[bands[n+1]][2]
+		}
+		e.putBit(uniformProb, v < 0)
+		if n == 15 {
+			break
+		}
+		// end of block
+		e.putBit(prob[0], n < last)
+	}
+
+	return 1
+}
+
+// putLevel writes the absolute value of a non-zero coefficient
+func (e *boolEncoder) putLevel(prob *[nProb]uint8, v int32) {
+	if v == 1 {
+		e.putBit(prob[2], false)
+
+		return
+	}
+	e.putBit(prob[2], true)
+
+	switch {
+	case v <= 4:
+		e.putBit(prob[3], false)
+		e.putBit(prob[4], v != 2)
+		if v != 2 {
+			e.putBit(prob[5], v == 4)
+		}
+	case v <= 10:
+		e.putBit(prob[3], true)
+		e.putBit(prob[6], false)
+		if v <= 6 {
+			e.putBit(prob[7], false)
+			e.putBit(159, v == 6)
+		} else {
+			e.putBit(prob[7], true)
+			e.putBit(165, (v-7)&2 != 0)
+			e.putBit(145, (v-7)&1 != 0)
+		}
+	default:
+		e.putBit(prob[3], true)
+		e.putBit(prob[6], true)
+		cat := 3
+		for cat > 0 && v < 3+8<<cat {
+			cat--
+		}
+		e.putBit(prob[8], cat >= 2)
+		e.putBit(prob[9+cat>>1], cat&1 != 0)
+		extra := v - (3 + 8<<cat)
+		tab := &cat3456[cat]
+		n := 0
+		for tab[n] != 0 {
+			n++
+		}
+		for i := 0; i < n; i++ {
+			e.putBit(tab[i], extra>>(n-1-i)&1 != 0)
+		}
+	}
+}
+
+// boolEncoder is the arithmetic coder of RFC 6386 section 7.3
+type boolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+// putBit writes the bit, prob is the probability of false out of 256
+func (e *boolEncoder) putBit(prob uint8, bit bool) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// putUint writes n bits of v starting from the most significant one
+func (e *boolEncoder) putUint(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.putBit(uniformProb, v>>i&1 != 0)
+	}
+}
+
+func (e *boolEncoder) carry() {
+	i := len(e.buf) - 1
+	for ; i >= 0 && e.buf[i] == 0xff; i-- {
+		e.buf[i] = 0
+	}
+	if i >= 0 {
+		e.buf[i]++
+	}
+}
+
+func (e *boolEncoder) flush() []byte {
+	c := e.bitCount
+	v := e.bottom
+	if v&(1<<(32-c)) != 0 {
+		e.carry()
+	}
+	v <<= c & 7
+	for c >>= 3; c > 0; c-- {
+		v <<= 8
+	}
+	for i := 0; i < 4; i++ {
+		e.buf = append(e.buf, byte(v>>24))
+		v <<= 8
+	}
+
+	return e.buf
+}
+
+// forwardDCT transforms a 4x4 block of residuals, it is the forward transform of libwebp
+func forwardDCT(in *[16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		d := in[4*i : 4*i+4]
+		a0, a1, a2, a3 := d[0]+d[3], d[1]+d[2], d[1]-d[2], d[0]-d[3]
+		tmp[4*i+0] = (a0 + a1) * 8
+		tmp[4*i+1] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[4*i+2] = (a0 - a1) * 8
+		tmp[4*i+3] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+
+	return out
+}
+
+// inverseDCT adds the inverse transform of the block to dst, exactly as decoders do
+func inverseDCT(dst []uint8, stride int, in *[16]int32) {
+	const (
+		c1 = 85627
+		c2 = 35468
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		row := dst[j*stride : j*stride+4]
+		row[0] = clip8(int32(row[0]) + (a+d)>>3)
+		row[1] = clip8(int32(row[1]) + (b+c)>>3)
+		row[2] = clip8(int32(row[2]) + (b-c)>>3)
+		row[3] = clip8(int32(row[3]) + (a-d)>>3)
+	}
+}
+
+// forwardWHT transforms DC coefficients of the 16 luma blocks into the Y2 block
+func forwardWHT(in *[16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		d := in[4*i : 4*i+4]
+		a0, a1, a2, a3 := d[0]+d[2], d[1]+d[3], d[1]-d[3], d[0]-d[2]
+		tmp[4*i+0] = a0 + a1
+		tmp[4*i+1] = a3 + a2
+		tmp[4*i+2] = a3 - a2
+		tmp[4*i+3] = a0 - a1
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[8+i], tmp[4+i]+tmp[12+i]
+		a2, a3 := tmp[4+i]-tmp[12+i], tmp[i]-tmp[8+i]
+		out[i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a3 - a2) >> 1
+		out[12+i] = (a0 - a1) >> 1
+	}
+
+	return out
+}
+
+// inverseWHT returns DC coefficients of the 16 luma blocks, exactly as decoders do
+func inverseWHT(in *[16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := in[i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[i] - in[12+i]
+		m[i], m[8+i], m[4+i], m[12+i] = a0+a1, a0-a1, a3+a2, a3-a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := m[4*i] + 3
+		a0 := dc + m[4*i+3]
+		a1 := m[4*i+1] + m[4*i+2]
+		a2 := m[4*i+1] - m[4*i+2]
+		a3 := dc - m[4*i+3]
+		out[4*i+0] = (a0 + a1) >> 3
+		out[4*i+1] = (a3 + a2) >> 3
+		out[4*i+2] = (a0 - a1) >> 3
+		out[4*i+3] = (a3 - a2) >> 3
+	}
+
+	return out
+}
+
+func clip8(v int32) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
@@ -0,0 +1,129 @@
+// Package webp encodes images to WebP without cgo, decoders are in golang.org/x/image/webp
+// Lossy images use 16x16 intra prediction of VP8 key frames, lossless images use VP8L
+// with subtract green and predictor transforms, backward references and a color cache.
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// DefaultQuality is used for lossy images when Options are nil
+const DefaultQuality = 75
+
+// MaxSize is the largest width and height, both are stored in 14 bits
+const MaxSize = 1 << 14
+
+// Options are the encoding parameters
+type Options struct {
+	// Lossless keeps every pixel, Quality is ignored then
+	Lossless bool
+	// Quality ranges from 1 to 100 inclusive, higher is better
+	Quality int
+}
+
+// Encode writes the image to w in WebP format
+func Encode(w io.Writer, img image.Image, o *Options) error {
+	opts := Options{Quality: DefaultQuality}
+	if o != nil {
+		opts = *o
+	}
+	if !opts.Lossless && (opts.Quality < 1 || opts.Quality > 100) {
+		return fmt.Errorf("webp error, invalid quality %d", opts.Quality)
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return errors.New("webp error, empty image")
+	}
+	if b.Dx() > MaxSize || b.Dy() > MaxSize {
+		return fmt.Errorf("webp error, %dx%d image is too large", b.Dx(), b.Dy())
+	}
+
+	nrgba := ToNRGBA(img)
+	if opts.Lossless {
+		return writeRIFF(w, chunk{"VP8L", encodeLossless(nrgba)})
+	}
+
+	vp8 := encodeLossy(nrgba, opts.Quality)
+	if Opaque(nrgba) {
+		return writeRIFF(w, chunk{"VP8 ", vp8})
+	}
+
+	return writeRIFF(w, chunk{"VP8X", extendedHeader(b.Dx(), b.Dy())}, chunk{"ALPH", encodeAlpha(nrgba)}, chunk{"VP8 ", vp8})
+}
+
+type chunk struct {
+	fourCC string
+	data   []byte
+}
+
+func writeRIFF(w io.Writer, chunks ...chunk) error {
+	size := 4
+	for _, c := range chunks {
+		size += 8 + len(c.data) + len(c.data)&1
+	}
+
+	buf := make([]byte, 0, 8+size)
+	buf = append(buf, "RIFF"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(size))
+	buf = append(buf, "WEBP"...)
+	for _, c := range chunks {
+		buf = append(buf, c.fourCC...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.data)))
+		buf = append(buf, c.data...)
+		// chunks are padded to an even size
+		if len(c.data)&1 == 1 {
+			buf = append(buf, 0)
+		}
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("webp error, %w", err)
+	}
+
+	return nil
+}
+
+// extendedHeader is the VP8X chunk, it is only needed to mark lossy images with alpha
+func extendedHeader(width, height int) []byte {
+	const alphaBit = 1 << 4
+	header := make([]byte, 10)
+	header[0] = alphaBit
+	putUint24(header[4:], uint32(width-1))
+	putUint24(header[7:], uint32(height-1))
+
+	return header
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// ToNRGBA returns the image with non-premultiplied colors starting at 0,0, NRGBA images there are not copied
+func ToNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	if m, ok := img.(*image.NRGBA); ok && b.Min == (image.Point{}) && m.Stride == 4*b.Dx() {
+		return m
+	}
+
+	m := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(m, m.Bounds(), img, b.Min, draw.Src)
+
+	return m
+}
+
+// Opaque reports whether every pixel has full alpha
+func Opaque(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,137 @@
+package webp
+
+import (
+	"bytes"
+	"foxyshot/imageprocessing/internal/testimages"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+func TestEncode_Lossless(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"single pixel", testimages.Screenshot(1, 1, false)},
+		{"odd size", testimages.Screenshot(17, 33, false)},
+		{"alpha", testimages.Screenshot(120, 70, true)},
+		{"text", testimages.Text(90, 45)},
+		{"flat", image.NewNRGBA(image.Rect(0, 0, 300, 20))},
+		{"sub-image", testimages.Screenshot(64, 64, true).SubImage(image.Rect(5, 7, 50, 40))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Encode(&buf, tt.img, &Options{Lossless: true}))
+
+			decoded, err := webp.Decode(&buf)
+			require.NoError(t, err)
+			want := ToNRGBA(tt.img)
+			require.Equal(t, want.Rect, decoded.Bounds())
+			assert.Equal(t, want.Pix, decoded.(*image.NRGBA).Pix)
+		})
+	}
+}
+
+func TestEncode_Lossy(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     *image.NRGBA
+		quality int
+		minPSNR float64
+	}{
+		{"high quality", testimages.Screenshot(200, 120, false), 90, 40},
+		{"default quality", testimages.Screenshot(200, 120, false), 75, 35},
+		{"low quality", testimages.Screenshot(200, 120, false), 30, 31},
+		{"odd size", testimages.Screenshot(37, 21, false), 90, 35},
+		{"single pixel", testimages.Screenshot(1, 1, false), 75, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Encode(&buf, tt.img, &Options{Quality: tt.quality}))
+
+			decoded, err := webp.Decode(&buf)
+			require.NoError(t, err)
+			require.Equal(t, tt.img.Rect, decoded.Bounds())
+			assert.Greater(t, psnr(tt.img, decoded), tt.minPSNR)
+		})
+	}
+}
+
+func TestEncode_LossyAlpha(t *testing.T) {
+	img := testimages.Screenshot(64, 40, true)
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, img, nil))
+
+	decoded, err := webp.Decode(&buf)
+	require.NoError(t, err)
+	require.IsType(t, &image.NYCbCrA{}, decoded)
+	m := decoded.(*image.NYCbCrA)
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 64; x++ {
+			require.Equal(t, img.NRGBAAt(x, y).A, m.A[m.AOffset(x, y)], "alpha is lossless at %d,%d", x, y)
+		}
+	}
+}
+
+func TestEncode_QualityReducesSize(t *testing.T) {
+	img := testimages.Screenshot(256, 256, false)
+	size := func(o *Options) int {
+		var buf bytes.Buffer
+		require.NoError(t, Encode(&buf, img, o))
+
+		return buf.Len()
+	}
+
+	assert.Less(t, size(&Options{Quality: 30}), size(&Options{Quality: 60}))
+	assert.Less(t, size(&Options{Quality: 60}), size(&Options{Quality: 90}))
+}
+
+func TestConvertDecoded(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, img, &Options{Quality: 90}))
+	decoded, err := webp.Decode(&buf)
+	require.NoError(t, err)
+
+	// limited range white is 235, it is light gray if converted as full range
+	assert.Equal(t, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, ConvertDecoded(decoded).At(3, 3))
+
+	lossless := testimages.Screenshot(4, 4, true)
+	assert.Same(t, lossless, ConvertDecoded(lossless))
+}
+
+func TestEncode_InvalidInput(t *testing.T) {
+	var buf bytes.Buffer
+	assert.EqualError(t, Encode(&buf, testimages.Screenshot(8, 8, false), &Options{Quality: 101}), "webp error, invalid quality 101")
+	assert.EqualError(t, Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 0, 5)), nil), "webp error, empty image")
+	assert.EqualError(t, Encode(&buf, image.NewGray(image.Rect(0, 0, 16385, 1)), nil), "webp error, 16385x1 image is too large")
+}
+
+// psnr compares RGB channels of an image decoded by golang.org/x/image/webp
+func psnr(want *image.NRGBA, decoded image.Image) float64 {
+	got := ConvertDecoded(decoded).(*image.NRGBA)
+	var sse float64
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			w, g := want.NRGBAAt(x, y), got.NRGBAAt(x, y)
+			for _, d := range []int{int(w.R) - int(g.R), int(w.G) - int(g.G), int(w.B) - int(g.B)} {
+				sse += float64(d * d)
+			}
+		}
+	}
+	mse := sse / float64(3*b.Dx()*b.Dy())
+
+	return 10 * math.Log10(255*255/math.Max(mse, 1e-9))
+}
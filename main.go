@@ -10,5 +10,6 @@ func main() {
 	err := cmd.RunCmd(os.Args)
 	if err != nil {
 		log.Printf("Cannot run command, got error: %v", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const jobExt = ".json"
+
+// Job is a screenshot waiting to be uploaded
+type Job struct {
+	ID string
+	// Processed screenshot stored in the queue folder
+	Path string
+	// Original screenshot, used in logs and object keys
+	Source string
+	// Modification time of the original screenshot, keeps {date} in object keys the same as without the queue
+	Taken time.Time
+	// Size of the processed screenshot in bytes
+	Size        int64
+	Created     time.Time
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+// Queue keeps failed uploads on disk, so they survive restarts
+// Each job is a processed file and a json file with its state
+type Queue struct {
+	dir string
+	mu  sync.Mutex
+	// added wakes up the retrier when a new job is queued
+	added chan struct{}
+}
+
+// New creates the queue folder if it does not exist
+func New(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("queue error, %w", err)
+	}
+
+	return &Queue{dir: dir, added: make(chan struct{}, 1)}, nil
+}
+
+// Add moves the processed file into the queue
+func (q *Queue) Add(path, source string, uploadErr error, retryAt time.Time) (*Job, error) {
+	id := uuid.NewString()
+	job := &Job{
+		ID:          id,
+		Path:        filepath.Join(q.dir, id+filepath.Ext(path)),
+		Source:      source,
+		Created:     time.Now(),
+		Attempts:    1,
+		NextAttempt: retryAt,
+		LastError:   uploadErr.Error(),
+	}
+	if err := moveFile(path, job.Path); err != nil {
+		return nil, fmt.Errorf("queue error, %w", err)
+	}
+	if stat, err := os.Stat(job.Path); err == nil {
+		job.Size = stat.Size()
+	}
+	job.Taken = job.Created
+	if stat, err := os.Stat(source); err == nil {
+		job.Taken = stat.ModTime()
+	}
+	if err := q.Save(job); err != nil {
+		_ = os.Remove(job.Path)
+
+		return nil, err
+	}
+
+	select {
+	case q.added <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+// Save stores the state of the job
+func (q *Queue) Save(job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("queue error, %w", err)
+	}
+	// write and rename, so a crash never leaves a truncated job behind
+	tmp := q.jobFile(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("queue error, %w", err)
+	}
+	if err := os.Rename(tmp, q.jobFile(job.ID)); err != nil {
+		return fmt.Errorf("queue error, %w", err)
+	}
+
+	return nil
+}
+
+// Remove deletes the job and its file
+func (q *Queue) Remove(job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.Remove(job.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("queue error, %w", err)
+	}
+	if err := os.Remove(q.jobFile(job.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("queue error, %w", err)
+	}
+
+	return nil
+}
+
+// Jobs returns queued jobs, the oldest first
+func (q *Queue) Jobs() ([]*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("queue error, %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), jobExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("queue error, %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("queue error, malformed job %s, %w", e.Name(), err)
+		}
+		jobs = append(jobs, &job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+
+	return jobs, nil
+}
+
+func (q *Queue) jobFile(id string) string {
+	return filepath.Join(q.dir, id+jobExt)
+}
+
+// moveFile renames the file, falling back to copying when the queue is on another device
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(dest)
+
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dest)
+
+		return err
+	}
+
+	return os.Remove(src)
+}
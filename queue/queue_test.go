@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue_AddSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	processed := createProcessedFile(t)
+
+	q, err := New(dir)
+	require.NoError(t, err)
+	retryAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	job, err := q.Add(processed, "original.png", errors.New("expected error"), retryAt)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, processed, "processed file must be moved into the queue")
+	assert.FileExists(t, job.Path)
+	assert.Equal(t, dir, filepath.Dir(job.Path))
+	assert.Equal(t, ".jpg", filepath.Ext(job.Path))
+
+	restarted, err := New(dir)
+	require.NoError(t, err)
+	jobs, err := restarted.Jobs()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+	assert.Equal(t, "original.png", jobs[0].Source)
+	assert.Equal(t, job.Size, jobs[0].Size)
+	assert.NotZero(t, jobs[0].Size)
+	assert.Equal(t, "expected error", jobs[0].LastError)
+	assert.Equal(t, 1, jobs[0].Attempts)
+	assert.True(t, retryAt.Equal(jobs[0].NextAttempt))
+}
+
+func TestQueue_AddKeepsTakenTime(t *testing.T) {
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+	original := filepath.Join(t.TempDir(), "original.png")
+	require.NoError(t, os.WriteFile(original, []byte("original"), 0600))
+	taken := time.Date(2001, time.March, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, os.Chtimes(original, taken, taken))
+
+	job, err := q.Add(createProcessedFile(t), original, errors.New("expected error"), time.Now())
+	require.NoError(t, err)
+	assert.True(t, taken.Equal(job.Taken))
+
+	missing, err := q.Add(createProcessedFile(t), "removed.png", errors.New("expected error"), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, missing.Created, missing.Taken, "the queue time is used if the original is gone")
+}
+
+func TestQueue_SaveAndRemove(t *testing.T) {
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+	job, err := q.Add(createProcessedFile(t), "original.png", errors.New("expected error"), time.Now())
+	require.NoError(t, err)
+
+	job.Attempts = 5
+	require.NoError(t, q.Save(job))
+	jobs, err := q.Jobs()
+	require.NoError(t, err)
+	assert.Equal(t, 5, jobs[0].Attempts)
+
+	require.NoError(t, q.Remove(job))
+	assert.NoFileExists(t, job.Path)
+	jobs, err = q.Jobs()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestQueue_JobsMalformed(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600))
+	q, err := New(dir)
+	require.NoError(t, err)
+
+	jobs, err := q.Jobs()
+
+	assert.Nil(t, jobs)
+	assert.ErrorContains(t, err, "queue error, malformed job broken.json")
+}
+
+func TestNew_InaccessibleFolder(t *testing.T) {
+	q, err := New("/dev/null/queue")
+
+	assert.Nil(t, q)
+	assert.ErrorContains(t, err, "queue error")
+}
+
+func createProcessedFile(t *testing.T) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "foxy_img*.jpg")
+	require.NoError(t, err)
+	_, err = f.WriteString("processed")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	return f.Name()
+}
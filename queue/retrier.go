@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"foxyshot/storage"
+)
+
+// idleInterval is how often the queue is checked when it has no jobs
+const idleInterval = time.Hour
+
+// Retrier uploads queued jobs with exponential backoff while the program runs
+type Retrier struct {
+	queue      *Queue
+	uploader   storage.Uploader
+	retryDelay time.Duration
+	maxDelay   time.Duration
+	// onUploaded is called after a queued job is uploaded
+	onUploaded func(job *Job, uploaded storage.Result)
+}
+
+// NewRetrier creates a Retrier, retryDelay is doubled after every failed attempt up to maxDelay
+func NewRetrier(q *Queue, u storage.Uploader, retryDelay, maxDelay time.Duration, onUploaded func(*Job, storage.Result)) *Retrier {
+	return &Retrier{queue: q, uploader: u, retryDelay: retryDelay, maxDelay: maxDelay, onUploaded: onUploaded}
+}
+
+// Delay returns how long to wait before the next attempt after the given number of attempts
+func (r *Retrier) Delay(attempts int) time.Duration {
+	delay := r.retryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.maxDelay {
+			return r.maxDelay
+		}
+	}
+
+	return delay
+}
+
+// Add queues a screenshot that failed to upload
+func (r *Retrier) Add(path, source string, uploadErr error) (*Job, error) {
+	return r.queue.Add(path, source, uploadErr, time.Now().Add(r.Delay(1)))
+}
+
+// Run retries due jobs until ctx is cancelled
+func (r *Retrier) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.queue.added:
+		case <-timer.C:
+		}
+
+		next := r.retryDue(ctx)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// retryDue uploads jobs that are due and returns the time of the next attempt
+func (r *Retrier) retryDue(ctx context.Context) time.Time {
+	next := time.Now().Add(idleInterval)
+
+	jobs, err := r.queue.Jobs()
+	if err != nil {
+		log.Printf("Cannot read upload queue, %v \n", err)
+
+		return next
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return next
+		}
+		if time.Now().Before(job.NextAttempt) {
+			if job.NextAttempt.Before(next) {
+				next = job.NextAttempt
+			}
+
+			continue
+		}
+
+		if r.retry(ctx, job) {
+			continue
+		}
+		if job.NextAttempt.Before(next) {
+			next = job.NextAttempt
+		}
+	}
+
+	return next
+}
+
+// retry uploads the job and reports whether it is done
+func (r *Retrier) retry(ctx context.Context, job *Job) bool {
+	uploaded, err := r.uploader.Upload(ctx, job.Path, storage.UploadOptions{Source: job.Source, Taken: job.Taken})
+	job.Attempts++
+	// partial failures of multiple destinations still produce a link and are not retried
+	if err != nil && uploaded.URL == "" {
+		job.LastError = err.Error()
+		job.NextAttempt = time.Now().Add(r.Delay(job.Attempts))
+		log.Printf("Retry %d of %s failed, next attempt at %s, reason: %v \n",
+			job.Attempts, job.Source, job.NextAttempt.Format(time.RFC3339), err)
+		if err := r.queue.Save(job); err != nil {
+			log.Printf("Cannot update queued upload %s, %v \n", job.ID, err)
+		}
+
+		return false
+	}
+
+	if err := r.queue.Remove(job); err != nil {
+		log.Printf("Cannot remove queued upload %s, %v \n", job.ID, err)
+	}
+	r.onUploaded(job, uploaded)
+
+	return true
+}
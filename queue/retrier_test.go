@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrier_Delay(t *testing.T) {
+	r := NewRetrier(nil, nil, time.Second, 10*time.Second, nil)
+
+	assert.Equal(t, time.Second, r.Delay(1))
+	assert.Equal(t, 2*time.Second, r.Delay(2))
+	assert.Equal(t, 8*time.Second, r.Delay(4))
+	assert.Equal(t, 10*time.Second, r.Delay(5))
+	assert.Equal(t, 10*time.Second, r.Delay(100))
+}
+
+func TestRetrier_Run(t *testing.T) {
+	q, err := New(t.TempDir())
+	require.NoError(t, err)
+	uploader := &flakyUploader{failures: 2}
+	uploaded := make(chan *Job, 1)
+	r := NewRetrier(q, uploader, time.Millisecond, 5*time.Millisecond, func(job *Job, result storage.Result) {
+		assert.Equal(t, "expected-url", result.URL)
+		uploaded <- job
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	_, err = r.Add(createProcessedFile(t), "original.png", errors.New("expected error"))
+	require.NoError(t, err)
+
+	select {
+	case job := <-uploaded:
+		assert.Equal(t, "original.png", job.Source)
+		assert.Equal(t, 4, job.Attempts)
+		assert.Equal(t, storage.UploadOptions{Source: "original.png", Taken: job.Taken}, uploader.opts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued job was not uploaded")
+	}
+
+	jobs, err := q.Jobs()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+// flakyUploader fails the given number of times before succeeding
+type flakyUploader struct {
+	mu       sync.Mutex
+	failures int
+	opts     storage.UploadOptions
+}
+
+func (u *flakyUploader) Upload(_ context.Context, _ string, opts storage.UploadOptions) (storage.Result, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.opts = opts
+	if u.failures > 0 {
+		u.failures--
+
+		return storage.Result{}, errors.New("still offline")
+	}
+
+	return storage.Result{URL: "expected-url"}, nil
+}
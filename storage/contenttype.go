@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// sniffLength is the number of bytes http.DetectContentType looks at
+	sniffLength = 512
+	// defaultContentType is used when the format cannot be detected
+	defaultContentType = "application/octet-stream"
+	defaultExt         = "bin"
+)
+
+// extensions maps sniffed content types to extensions used in keys, mime.ExtensionsByType is used for others
+var extensions = map[string]string{
+	"image/jpeg":      "jpg",
+	"image/png":       "png",
+	"image/gif":       "gif",
+	"image/webp":      "webp",
+	"image/bmp":       "bmp",
+	"image/x-icon":    "ico",
+	"image/svg+xml":   "svg",
+	"video/mp4":       "mp4",
+	"video/webm":      "webm",
+	"video/avi":       "avi",
+	"application/pdf": "pdf",
+	"text/plain":      "txt",
+}
+
+// fileType describes the contents of an uploaded file
+type fileType struct {
+	ContentType string
+	Ext         string
+}
+
+// detectFileType sniffs the first bytes of the file, the file extension is used if the format is not recognized
+func detectFileType(path string) (fileType, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return fileType{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fileType{}, err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if ext := extensionByType(contentType); ext != "" && contentType != defaultContentType {
+		return fileType{ContentType: contentType, Ext: ext}, nil
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "" {
+		return fileType{ContentType: contentType, Ext: defaultExt}, nil
+	}
+	if byExt := mime.TypeByExtension("." + ext); byExt != "" {
+		contentType = byExt
+	}
+
+	return fileType{ContentType: contentType, Ext: ext}, nil
+}
+
+func extensionByType(contentType string) string {
+	if ext, ok := extensions[contentType]; ok {
+		return ext
+	}
+
+	exts, err := mime.ExtensionsByType(contentType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+
+	return strings.TrimPrefix(exts[0], ".")
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFileType(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		want    fileType
+	}{
+		{"png", "shot", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), fileType{"image/png", "png"}},
+		{"jpeg", "shot", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), fileType{"image/jpeg", "jpg"}},
+		{"gif", "shot", []byte("GIF89a\x01\x00\x01\x00"), fileType{"image/gif", "gif"}},
+		{"webp", "shot", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), fileType{"image/webp", "webp"}},
+		{"mp4", "shot", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), fileType{"video/mp4", "mp4"}},
+		{"content wins over extension", "shot.jpg", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), fileType{"image/png", "png"}},
+		{"unknown with extension", "shot.tiff", []byte("II*\x00\x08\x00\x00\x00"), fileType{"image/tiff", "tiff"}},
+		{"unknown", "shot", []byte{0x00, 0x01, 0x02}, fileType{"application/octet-stream", "bin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, tt.content, 0600))
+
+			got, err := detectFileType(path)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDetectFileType_Missing(t *testing.T) {
+	_, err := detectFileType(filepath.Join(t.TempDir(), "missing"))
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// alreadyUploaded checks the local cache first and asks the bucket if the cache does not know the key
+// With retention the cache is off, objects that would be swept before the link expires are uploaded again.
+func (u *s3CompatibleUploader) alreadyUploaded(ctx context.Context, key string, duration time.Duration) bool {
+	if u.cache != nil && u.cache.has(u.cacheEntry(key)) {
+		return true
+	}
+
+	exists, modified, err := u.headObject(ctx, key)
+	if err != nil {
+		log.Printf("Cannot check if %s exists, uploading it again: %v \n", key, err)
+	}
+	if exists && u.config.Retention > 0 && modified.Add(u.config.Retention).Before(time.Now().Add(duration)) {
+		log.Printf("%s would be deleted before the link expires, uploading it again \n", key)
+
+		return false
+	}
+	if exists {
+		u.remember(key)
+	}
+
+	return exists
+}
+
+// objectExists asks the bucket for the object, missing objects are not an error
+func (u *s3CompatibleUploader) objectExists(ctx context.Context, key string) (bool, error) {
+	exists, _, err := u.headObject(ctx, key)
+
+	return exists, err
+}
+
+// headObject returns when the object was uploaded if it exists
+func (u *s3CompatibleUploader) headObject(ctx context.Context, key string) (bool, time.Time, error) {
+	input := s3.HeadObjectInput{
+		Bucket: aws.String(u.config.Bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = u.customerKey()
+	out, err := u.client.HeadObjectWithContext(ctx, &input)
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == 404 {
+			return false, time.Time{}, nil
+		}
+
+		return false, time.Time{}, err
+	}
+
+	return true, aws.TimeValue(out.LastModified), nil
+}
+
+func (u *s3CompatibleUploader) remember(key string) {
+	if u.cache == nil {
+		return
+	}
+	if err := u.cache.add(u.cacheEntry(key)); err != nil {
+		log.Printf("Cannot save %s in the upload cache, %v \n", key, err)
+	}
+}
+
+// cacheEntry makes keys unique across buckets and providers sharing the cache file
+func (u *s3CompatibleUploader) cacheEntry(key string) string {
+	return u.config.Endpoint + "/" + u.config.Bucket + "/" + key
+}
+
+// uploadCache is a file with uploaded keys, one per line
+type uploadCache struct {
+	path string
+
+	mu     sync.Mutex
+	keys   map[string]bool
+	loaded bool
+}
+
+func newUploadCache(path string) *uploadCache {
+	return &uploadCache{path: path, keys: make(map[string]bool)}
+}
+
+func (c *uploadCache) has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		log.Printf("Cannot read the upload cache, %v \n", err)
+	}
+
+	return c.keys[key]
+}
+
+func (c *uploadCache) add(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		return err
+	}
+	if c.keys[key] {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		f.Close()
+
+		return err
+	}
+	c.keys[key] = true
+
+	return f.Close()
+}
+
+// remove rewrites the file without the key
+func (c *uploadCache) remove(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		return err
+	}
+	if !c.keys[key] {
+		return nil
+	}
+	delete(c.keys, key)
+
+	var b strings.Builder
+	for k := range c.keys {
+		b.WriteString(k + "\n")
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+// load reads the cache file once, a missing file is an empty cache
+func (c *uploadCache) load() error {
+	if c.loaded {
+		return nil
+	}
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.loaded = true
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		c.keys[scanner.Text()] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	c.loaded = true
+
+	return nil
+}
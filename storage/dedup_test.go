@@ -0,0 +1,116 @@
+package storage_test
+
+import (
+	"context"
+	"foxyshot/storage"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Uploader_Deduplicate(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.KeyTemplate = "{hash}.{ext}"
+	s3Config.Deduplicate = true
+	cache := filepath.Join(t.TempDir(), "cache", "uploaded")
+	s3Config.DedupCache = cache
+	file := createFakeUpload(t)
+
+	first, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, fake.attempts())
+	assert.Regexp(t, "^[0-9a-f]{32}.txt$", objectKey(t, first.URL))
+
+	second, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, fake.attempts(), "known file must not be uploaded again")
+
+	// a new cache still finds the object with HEAD
+	require.NoError(t, os.Remove(cache))
+	third, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, first, third)
+	assert.Equal(t, 1, fake.attempts(), "existing object must not be uploaded again")
+	assert.FileExists(t, cache)
+}
+
+func TestS3Uploader_DeduplicateWithRetention(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.KeyTemplate = "screenshots/{hash}.{ext}"
+	s3Config.Deduplicate = true
+	s3Config.Retention = 48 * time.Hour
+	s3Config.Duration = 24 * time.Hour
+	file := createFakeUpload(t)
+
+	first, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, fake.attempts())
+
+	// the link of a recent object expires before the object
+	fake.store(objectKey(t, first.URL), "fake-upload", time.Now().Add(-12*time.Hour))
+	_, err = storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, fake.attempts(), "recent object must not be uploaded again")
+
+	// the sweeper would delete an older object while the link still works
+	fake.store(objectKey(t, first.URL), "fake-upload", time.Now().Add(-36*time.Hour))
+	_, err = storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.attempts(), "object close to retention must be uploaded again")
+}
+
+func TestS3Uploader_HashIsKeyed(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	file := createFakeUpload(t)
+
+	keys := make([]string, 0, 2)
+	for _, hashKey := range []string{"first secret", "second secret"} {
+		s3Config := fakeS3Config(server.URL, 1, 0)
+		s3Config.KeyTemplate = "{hash}"
+		s3Config.HashKey = hashKey
+
+		uploaded, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), file, storage.UploadOptions{})
+		require.NoError(t, err)
+		keys = append(keys, objectKey(t, uploaded.URL))
+	}
+
+	assert.NotEqual(t, keys[0], keys[1])
+}
+
+func TestS3Uploader_DeduplicateChangedFile(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.KeyTemplate = "{hash}.{ext}"
+	s3Config.Deduplicate = true
+	uploader := storage.NewS3Uploader(s3Config)
+
+	first, err := uploader.Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+	require.NoError(t, err)
+	f, err := createUploadFile("other contents")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	second, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, objectKey(t, first.URL), objectKey(t, second.URL))
+	assert.Equal(t, 2, fake.attempts())
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"foxyshot/config"
+)
+
+// ErrDeleteNotSupported is returned for destinations that cannot remove uploaded files, e.g. http
+var ErrDeleteNotSupported = errors.New("deleting is not supported")
+
+// Deleter is implemented by uploaders that can remove uploaded files
+// Deleting a missing file is not an error, so a takedown can be repeated safely
+type Deleter interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// NewDeleter creates the Deleter for the destination with the name, the top-level destination is used if it is empty
+func NewDeleter(c *config.Config, destination string) (Deleter, error) {
+	u, name, err := destinationUploader(c, destination)
+	if err != nil {
+		return nil, err
+	}
+	deleter, ok := u.(Deleter)
+	if !ok {
+		return nil, fmt.Errorf("%s, %w", name, ErrDeleteNotSupported)
+	}
+
+	return deleter, nil
+}
+
+// destinationUploader creates the uploader of a single destination, the name is for errors
+func destinationUploader(c *config.Config, name string) (Uploader, string, error) {
+	d, err := findDestination(c, name)
+	if err != nil {
+		return nil, "", err
+	}
+	u, err := newDestination(d)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return u, destinationName(d), nil
+}
+
+func findDestination(c *config.Config, name string) (*config.Destination, error) {
+	if len(c.Destinations) == 0 {
+		if name == "" || name == destinationName(&c.Destination) {
+			return &c.Destination, nil
+		}
+
+		return nil, fmt.Errorf("unknown destination %q", name)
+	}
+
+	for i := range c.Destinations {
+		d := &c.Destinations[i]
+		if (name == "" && d.Primary) || destinationName(d) == name {
+			return d, nil
+		}
+	}
+	if name == "" {
+		return &c.Destinations[0], nil
+	}
+
+	return nil, fmt.Errorf("unknown destination %q", name)
+}
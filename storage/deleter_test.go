@@ -0,0 +1,83 @@
+package storage_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Uploader_Delete(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	uploader := newFakeS3Uploader(server.URL, 1, 0)
+
+	uploaded, err := uploader.Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+	require.NoError(t, err)
+	require.Contains(t, fake.keys(), uploaded.Key)
+
+	deleter, ok := uploader.(storage.Deleter)
+	require.True(t, ok)
+	require.NoError(t, deleter.Delete(context.Background(), uploaded.Key))
+	assert.Empty(t, fake.keys())
+	assert.NoError(t, deleter.Delete(context.Background(), uploaded.Key), "deleting twice must not fail")
+}
+
+func TestLocalUploader_Delete(t *testing.T) {
+	dir := t.TempDir()
+	uploader := storage.NewLocalUploader(&config.LocalConfig{Dir: dir})
+	uploaded, err := uploader.Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+	require.NoError(t, err)
+
+	deleter := uploader.(storage.Deleter)
+	require.NoError(t, deleter.Delete(context.Background(), uploaded.Key))
+	assert.NoFileExists(t, filepath.Join(dir, uploaded.Key))
+	assert.NoError(t, deleter.Delete(context.Background(), uploaded.Key), "deleting twice must not fail")
+
+	assert.ErrorContains(t, deleter.Delete(context.Background(), "../config.json"), "invalid key")
+}
+
+func TestWebDAVUploader_Delete(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	server := httptest.NewServer(withBasicAuth(newDAVHandler()))
+	defer server.Close()
+
+	uploader := storage.NewWebDAVUploader(&config.WebDAVConfig{
+		URL:      server.URL + "/screenshots",
+		Username: testUser,
+		Password: testPass,
+	})
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	require.NoError(t, err)
+
+	deleter := uploader.(storage.Deleter)
+	require.NoError(t, deleter.Delete(context.Background(), uploaded.Key))
+	assert.NoError(t, deleter.Delete(context.Background(), uploaded.Key), "deleting twice must not fail")
+}
+
+func TestNewDeleter(t *testing.T) {
+	c := &config.Config{Destinations: []config.Destination{
+		{Name: "share", Backend: config.BackendHTTP, HTTP: config.HTTPConfig{URL: "https://share.example.com/upload"}},
+		{Name: "archive", Backend: config.BackendLocal, Local: config.LocalConfig{Dir: t.TempDir()}, Primary: true},
+	}}
+
+	primary, err := storage.NewDeleter(c, "")
+	assert.NoError(t, err)
+	assert.NotNil(t, primary)
+
+	_, err = storage.NewDeleter(c, "share")
+	assert.ErrorIs(t, err, storage.ErrDeleteNotSupported)
+
+	_, err = storage.NewDeleter(c, "missing")
+	assert.EqualError(t, err, `unknown destination "missing"`)
+}
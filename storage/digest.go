@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// digestChallenge holds parameters of HTTP digest authentication (RFC 7616) sent by the server
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	count     int
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	scheme, params, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Digest") {
+		return nil, fmt.Errorf("digest auth error, unsupported challenge %q", header)
+	}
+
+	values := parseAuthParams(params)
+	c := &digestChallenge{
+		realm:     values["realm"],
+		nonce:     values["nonce"],
+		opaque:    values["opaque"],
+		algorithm: values["algorithm"],
+	}
+	for _, qop := range strings.Split(values["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			c.qop = "auth"
+		}
+	}
+	if c.nonce == "" {
+		return nil, fmt.Errorf("digest auth error, no nonce in %q", header)
+	}
+	if c.newHash() == nil {
+		return nil, fmt.Errorf("digest auth error, unsupported algorithm %q", c.algorithm)
+	}
+
+	return c, nil
+}
+
+// parseAuthParams splits comma separated key=value pairs, values may be quoted and contain commas
+func parseAuthParams(s string) map[string]string {
+	values := make(map[string]string)
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		values[key] = strings.TrimSpace(val)
+		s = rest
+	}
+
+	return values
+}
+
+func (c *digestChallenge) newHash() hash.Hash {
+	switch strings.ToUpper(c.algorithm) {
+	case "", "MD5":
+		return md5.New()
+	case "SHA-256":
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+func (c *digestChallenge) hash(parts ...string) string {
+	h := c.newHash()
+	h.Write([]byte(strings.Join(parts, ":")))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorization builds the value of the Authorization header, it is not safe for concurrent use
+func (c *digestChallenge) authorization(method, uri, username, password string) string {
+	ha1 := c.hash(username, c.realm, password)
+	ha2 := c.hash(method, uri)
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, username),
+		fmt.Sprintf(`realm="%s"`, c.realm),
+		fmt.Sprintf(`nonce="%s"`, c.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+	}
+	if c.qop == "" {
+		fields = append(fields, fmt.Sprintf(`response="%s"`, c.hash(ha1, c.nonce, ha2)))
+	} else {
+		c.count++
+		nc := fmt.Sprintf("%08x", c.count)
+		cnonce := newCnonce()
+		fields = append(fields,
+			"qop="+c.qop,
+			"nc="+nc,
+			fmt.Sprintf(`cnonce="%s"`, cnonce),
+			fmt.Sprintf(`response="%s"`, c.hash(ha1, c.nonce, nc, cnonce, c.qop, ha2)),
+		)
+	}
+	if c.algorithm != "" {
+		fields = append(fields, "algorithm="+c.algorithm)
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, c.opaque))
+	}
+
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
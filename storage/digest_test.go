@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDigestChallenge(t *testing.T) {
+	c, err := parseDigestChallenge(`Digest realm="dav, files", nonce="abc", qop="auth-int,auth", opaque="xyz", algorithm=SHA-256`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "dav, files", c.realm)
+	assert.Equal(t, "abc", c.nonce)
+	assert.Equal(t, "auth", c.qop)
+	assert.Equal(t, "xyz", c.opaque)
+	assert.Equal(t, "SHA-256", c.algorithm)
+}
+
+func TestParseDigestChallenge_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		errMsg string
+	}{
+		{"basic challenge", `Basic realm="dav"`, `digest auth error, unsupported challenge "Basic realm=\"dav\""`},
+		{"no nonce", `Digest realm="dav"`, `digest auth error, no nonce in "Digest realm=\"dav\""`},
+		{"unknown algorithm", `Digest nonce="n", algorithm=SHA-512-256`, `digest auth error, unsupported algorithm "SHA-512-256"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseDigestChallenge(tt.header)
+
+			assert.Nil(t, c)
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestDigestChallenge_AuthorizationWithoutQop(t *testing.T) {
+	// example from RFC 2069
+	c := &digestChallenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41"}
+
+	header := c.authorization("GET", "/dir/index.html", "Mufasa", "CircleOfLife")
+
+	assert.Contains(t, header, `response="1949323746fe6a43ef61f9606e7febea"`)
+	assert.Contains(t, header, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	assert.NotContains(t, header, "nc=")
+}
+
+func TestParentURL(t *testing.T) {
+	assert.Equal(t, "https://example.com/a/", parentURL("https://example.com/a/b/"))
+	assert.Equal(t, "https://example.com/", parentURL("https://example.com/a"))
+	assert.Equal(t, "https://example.com/", parentURL("https://example.com/"))
+}
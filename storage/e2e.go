@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// e2eKeyLength is the size of AES-256 keys
+	e2eKeyLength = 32
+	// defaultViewerKey is used if ViewerKey is not set
+	defaultViewerKey = "viewer.html"
+	// viewerCheckInterval is how long the viewer is trusted to stay in the bucket, e.g. until a lifecycle rule removes it
+	viewerCheckInterval = time.Hour
+)
+
+// viewerHTML decrypts screenshots in the browser, it is uploaded to the bucket before the first encrypted screenshot
+//
+//go:embed viewer.html
+var viewerHTML []byte
+
+// encryptFile writes nonce and AES-GCM ciphertext of the file with a random key to a temporary file
+func encryptFile(path string) (encrypted string, key []byte, err error) {
+	plain, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key = make([]byte, e2eKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+
+	file, err := os.CreateTemp("", "foxyshot_encrypted")
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = file.Write(gcm.Seal(nonce, nonce, plain, nil))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+
+		return "", nil, err
+	}
+
+	return file.Name(), key, nil
+}
+
+// viewerLink points to the viewer, the fragment with the key is not sent to servers by browsers
+func (u *s3CompatibleUploader) viewerLink(ctx context.Context, objectURL, contentType string, key []byte, duration time.Duration) (string, error) {
+	fragment := url.Values{}
+	fragment.Set("k", base64.RawURLEncoding.EncodeToString(key))
+	fragment.Set("t", contentType)
+
+	return u.withViewer(ctx, objectURL, fragment, duration)
+}
+
+// renewViewerLink replaces the object link in the fragment of the previous viewer link
+func (u *s3CompatibleUploader) renewViewerLink(ctx context.Context, objectURL, previous string, duration time.Duration) (string, error) {
+	_, encoded, _ := strings.Cut(previous, "#")
+	fragment, err := url.ParseQuery(encoded)
+	if err != nil || fragment.Get("k") == "" {
+		return "", errors.New("the screenshot is encrypted, the key is only in the link saved in history")
+	}
+
+	return u.withViewer(ctx, objectURL, fragment, duration)
+}
+
+func (u *s3CompatibleUploader) withViewer(ctx context.Context, objectURL string, fragment url.Values, duration time.Duration) (string, error) {
+	if err := u.ensureViewer(ctx); err != nil {
+		return "", fmt.Errorf("cannot upload viewer, %w", err)
+	}
+	viewerURL, err := u.generateURL(u.viewerKey(), duration)
+	if err != nil {
+		return "", err
+	}
+	fragment.Set("u", objectURL)
+
+	return viewerURL + "#" + fragment.Encode(), nil
+}
+
+// ensureViewer uploads the viewer if the bucket does not have it, the bucket is checked every viewerCheckInterval
+func (u *s3CompatibleUploader) ensureViewer(ctx context.Context) error {
+	u.viewerMu.Lock()
+	defer u.viewerMu.Unlock()
+	if !u.viewerChecked.IsZero() && time.Since(u.viewerChecked) < viewerCheckInterval {
+		return nil
+	}
+
+	key := u.viewerKey()
+	exists, err := u.objectExists(ctx, key)
+	if err != nil {
+		log.Printf("Cannot check if %s exists, uploading it again: %v \n", key, err)
+	}
+	if !exists {
+		body := bytes.NewReader(viewerHTML)
+		input := s3.PutObjectInput{
+			Bucket:      aws.String(u.config.Bucket),
+			Key:         aws.String(key),
+			Body:        body,
+			ACL:         aws.String(u.acl()),
+			ContentType: aws.String("text/html; charset=utf-8"),
+		}
+		u.setEncryption(&input)
+		if _, err := u.putObject(ctx, &input, body); err != nil {
+			return err
+		}
+		log.Printf("Uploaded viewer as %s \n", key)
+	}
+	u.viewerChecked = time.Now()
+
+	return nil
+}
+
+func (u *s3CompatibleUploader) viewerKey() string {
+	return viewerKeyOf(u.config)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"foxyshot/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Uploader_EnsureViewerRechecks(t *testing.T) {
+	var heads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+	}))
+	defer server.Close()
+	u := NewS3Uploader(&config.S3Config{Endpoint: server.URL, Bucket: "shots", Region: "us-east-1", Key: "key", Secret: "secret"}).(*s3CompatibleUploader)
+
+	require.NoError(t, u.ensureViewer(context.Background()))
+	require.NoError(t, u.ensureViewer(context.Background()))
+	assert.Equal(t, int32(1), heads.Load(), "the viewer is not checked for every screenshot")
+
+	u.viewerChecked = time.Now().Add(-viewerCheckInterval)
+	require.NoError(t, u.ensureViewer(context.Background()))
+	assert.Equal(t, int32(2), heads.Load(), "the viewer may be removed from the bucket")
+}
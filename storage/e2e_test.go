@@ -0,0 +1,85 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Uploader_Encrypt(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.Encrypt = true
+	u := storage.NewS3Uploader(s3Config)
+	source := "../imageprocessing/testdata/valid.png"
+
+	uploaded, err := u.Upload(context.Background(), source, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, fake.attempts(), "the viewer is uploaded with the first screenshot")
+
+	viewerURL, fragment, found := strings.Cut(uploaded.URL, "#")
+	require.True(t, found)
+	assert.Equal(t, server.URL+"/"+testBucket+"/viewer.html", viewerURL)
+	params, err := url.ParseQuery(fragment)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", params.Get("t"))
+	assert.Regexp(t, `\.bin$`, uploaded.Key)
+	assert.Equal(t, server.URL+"/"+testBucket+"/"+uploaded.Key, params.Get("u"))
+
+	key, err := base64.RawURLEncoding.DecodeString(params.Get("k"))
+	require.NoError(t, err)
+	plain, err := decrypt(download(t, params.Get("u")), key)
+	require.NoError(t, err)
+	expected, err := os.ReadFile(source)
+	require.NoError(t, err)
+	assert.Equal(t, expected, plain)
+	assert.Contains(t, string(download(t, viewerURL)), "crypto.subtle.decrypt")
+
+	second, err := u.Upload(context.Background(), source, storage.UploadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, fake.attempts(), "the viewer is uploaded once")
+	assert.Equal(t, "application/octet-stream", fake.lastHeader.Get("Content-Type"))
+	assert.NotEqual(t, uploaded.URL, second.URL)
+}
+
+func download(t *testing.T, link string) []byte {
+	t.Helper()
+	resp, err := http.Get(link)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return body
+}
+
+// decrypt does the same as the viewer in the browser
+func decrypt(data, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
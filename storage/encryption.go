@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// sseCustomerAlgorithm is the only algorithm S3 supports for SSE-C
+const sseCustomerAlgorithm = "AES256"
+
+// setEncryption adds server-side encryption and the storage class from config to the request
+func (u *s3CompatibleUploader) setEncryption(input *s3.PutObjectInput) {
+	if u.config.ServerSideEncryption != "" {
+		input.ServerSideEncryption = aws.String(u.config.ServerSideEncryption)
+	}
+	if u.config.SSEKMSKeyId != "" {
+		input.SSEKMSKeyId = aws.String(u.config.SSEKMSKeyId)
+	}
+	if u.config.StorageClass != "" {
+		input.StorageClass = aws.String(u.config.StorageClass)
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = u.customerKey()
+}
+
+// customerKey returns the SSE-C algorithm and key for requests reading or writing objects, nil if SSE-C is off
+func (u *s3CompatibleUploader) customerKey() (*string, *string) {
+	if u.sseCustomerKey == "" {
+		return nil, nil
+	}
+
+	return aws.String(sseCustomerAlgorithm), aws.String(u.sseCustomerKey)
+}
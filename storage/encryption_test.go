@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"foxyshot/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignURL_SSECustomerKey(t *testing.T) {
+	key := make([]byte, 32)
+	u := NewS3Uploader(&config.S3Config{
+		Key:            "key",
+		Secret:         "secret",
+		Endpoint:       "https://s3.example.com",
+		Region:         "eu-west-1",
+		Bucket:         "foxy",
+		Duration:       time.Hour,
+		SSECustomerKey: base64.StdEncoding.EncodeToString(key),
+	}).(*s3CompatibleUploader)
+
+	signed, err := u.signURL("shot.png", time.Hour)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	query := parsed.Query()
+	assert.Contains(t, query.Get("X-Amz-SignedHeaders"), "x-amz-server-side-encryption-customer-key")
+	assert.NotContains(t, signed, base64.StdEncoding.EncodeToString(key), "the key must not leak into the link")
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// failoverUploader tries destinations in order until one of them stores the screenshot
+type failoverUploader struct {
+	destinations []namedUploader
+}
+
+func newFailoverUploader(destinations []namedUploader) *failoverUploader {
+	return &failoverUploader{destinations: destinations}
+}
+
+// Upload returns the result of the first destination that succeeded, Result.Destination tells which one it was
+func (u *failoverUploader) Upload(ctx context.Context, path string, opts UploadOptions) (Result, error) {
+	failed := make([]string, 0, len(u.destinations))
+	for _, d := range u.destinations {
+		r, err := d.Upload(ctx, path, opts)
+		if err == nil {
+			if len(failed) > 0 {
+				log.Printf("Uploaded %s to %s after failures: %s \n", path, r.Destination, strings.Join(failed, "; "))
+			}
+
+			return r, nil
+		}
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return Result{}, err
+		}
+		log.Printf("Upload of %s failed, trying next destination: %v \n", path, err)
+		failed = append(failed, err.Error())
+	}
+
+	return Result{}, fmt.Errorf("all destinations failed, %s", strings.Join(failed, "; "))
+}
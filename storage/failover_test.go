@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailoverUploader_Upload(t *testing.T) {
+	errExpected := errors.New("expected error")
+	first := &mockUploader{result: mockResult{err: errExpected}}
+	second := &mockUploader{result: mockResult{url: "second"}}
+	third := &mockUploader{result: mockResult{url: "third"}}
+
+	u := newFailoverUploader([]namedUploader{
+		{name: "first", Uploader: first},
+		{name: "second", Uploader: second},
+		{name: "third", Uploader: third},
+	})
+	uploaded, err := u.Upload(context.Background(), "expected-path", UploadOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Result{URL: "second", Destination: "second"}, uploaded)
+	assert.Equal(t, "expected-path", first.pathUploaded)
+	assert.Equal(t, "", third.pathUploaded, "destinations after the successful one must not be used")
+}
+
+func TestFailoverUploader_UploadTimeout(t *testing.T) {
+	u := newFailoverUploader([]namedUploader{
+		{name: "slow", timeout: 10 * time.Millisecond, Uploader: &blockingUploader{}},
+		{name: "fast", Uploader: &mockUploader{result: mockResult{url: "fast"}}},
+	})
+
+	uploaded, err := u.Upload(context.Background(), "expected-path", UploadOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", uploaded.Destination)
+}
+
+func TestFailoverUploader_UploadAllFailed(t *testing.T) {
+	u := newFailoverUploader([]namedUploader{
+		{name: "first", Uploader: &mockUploader{result: mockResult{err: errors.New("down")}}},
+		{name: "second", Uploader: &mockUploader{result: mockResult{err: errors.New("forbidden")}}},
+	})
+
+	uploaded, err := u.Upload(context.Background(), "expected-path", UploadOptions{})
+
+	assert.Empty(t, uploaded.URL)
+	assert.EqualError(t, err, "all destinations failed, first: down; second: forbidden")
+}
+
+func TestFailoverUploader_UploadCancelled(t *testing.T) {
+	second := &mockUploader{result: mockResult{url: "second"}}
+	u := newFailoverUploader([]namedUploader{
+		{name: "first", Uploader: &blockingUploader{}},
+		{name: "second", Uploader: second},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := u.Upload(ctx, "expected-path", UploadOptions{})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "", second.pathUploaded)
+}
+
+// blockingUploader waits until the context is done
+type blockingUploader struct{}
+
+func (b *blockingUploader) Upload(ctx context.Context, _ string, _ UploadOptions) (Result, error) {
+	<-ctx.Done()
+
+	return Result{}, ctx.Err()
+}
@@ -0,0 +1,245 @@
+package storage_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"foxyshot/config"
+	"foxyshot/storage"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 stores objects in memory, PutObject requests fail or are delayed as configured
+type fakeS3 struct {
+	mu       sync.Mutex
+	failures []int
+	delays   []time.Duration
+	count    int
+	lastBody string
+	lastPath string
+	// headers of the last stored object
+	lastHeader http.Header
+	objects    map[string]string
+	// upload times of objects, listed as LastModified
+	modified map[string]time.Time
+	// protected keys cannot be deleted with DeleteObjects
+	protected map[string]bool
+	// number of DeleteObjects requests
+	batchDeletes int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		f.deleteObjects(w, r)
+
+		return
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.listObjects(w, r)
+
+		return
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		f.serveObject(w, r)
+
+		return
+	case r.Method == http.MethodDelete:
+		f.mu.Lock()
+		delete(f.objects, r.URL.Path)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	f.mu.Lock()
+	attempt := f.count
+	f.count++
+	f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if attempt < len(f.delays) {
+		select {
+		case <-time.After(f.delays[attempt]):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if attempt < len(f.failures) {
+		status := f.failures[attempt]
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>fake</Message></Error>`, s3ErrorCode(status))
+
+		return
+	}
+
+	f.mu.Lock()
+	f.lastBody = string(body)
+	f.lastPath = r.URL.Path
+	f.lastHeader = r.Header.Clone()
+	if f.objects == nil {
+		f.objects = make(map[string]string)
+	}
+	f.objects[r.URL.Path] = string(body)
+	if f.modified == nil {
+		f.modified = make(map[string]time.Time)
+	}
+	f.modified[r.URL.Path] = time.Now()
+	f.mu.Unlock()
+	w.Header().Set("ETag", `"fake"`)
+}
+
+func (f *fakeS3) serveObject(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	body, ok := f.objects[r.URL.Path]
+	modified := f.modified[r.URL.Path]
+	f.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	_, _ = io.WriteString(w, body)
+}
+
+// listObjects supports a single page of ListObjectsV2 for path-style requests
+func (f *fakeS3) listObjects(w http.ResponseWriter, r *http.Request) {
+	bucket := r.URL.Path + "/"
+	prefix := r.URL.Query().Get("prefix")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths := make([]string, 0, len(f.objects))
+	for path := range f.objects {
+		if strings.HasPrefix(path, bucket+prefix) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>`, len(paths))
+	for _, path := range paths {
+		_, _ = fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>%d</Size></Contents>`,
+			strings.TrimPrefix(path, bucket), f.modified[path].UTC().Format(time.RFC3339), len(f.objects[path]))
+	}
+	_, _ = io.WriteString(w, `</ListBucketResult>`)
+}
+
+// deleteObjects supports quiet DeleteObjects requests for path-style requests
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batchDeletes++
+
+	_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><DeleteResult>`)
+	for _, o := range request.Objects {
+		if f.protected[o.Key] {
+			_, _ = fmt.Fprintf(w, `<Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`, o.Key)
+
+			continue
+		}
+		delete(f.objects, r.URL.Path+"/"+o.Key)
+	}
+	_, _ = io.WriteString(w, `</DeleteResult>`)
+}
+
+// store adds an object uploaded at the given time
+func (f *fakeS3) store(key, body string, modified time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.objects == nil {
+		f.objects = make(map[string]string)
+		f.modified = make(map[string]time.Time)
+	}
+	f.objects["/"+testBucket+"/"+key] = body
+	f.modified["/"+testBucket+"/"+key] = modified
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for path := range f.objects {
+		keys = append(keys, strings.TrimPrefix(path, "/"+testBucket+"/"))
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (f *fakeS3) attempts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.count
+}
+
+func s3ErrorCode(status int) string {
+	switch status {
+	case http.StatusForbidden:
+		return "AccessDenied"
+	case http.StatusTooManyRequests:
+		return "SlowDown"
+	case http.StatusServiceUnavailable:
+		return "ServiceUnavailable"
+	default:
+		return "InternalError"
+	}
+}
+
+func fakeS3Config(endpoint string, maxAttempts int, attemptTimeout time.Duration) *config.S3Config {
+	return &config.S3Config{
+		Key:            testUser,
+		Secret:         testPass,
+		Region:         "eu-west-1",
+		Bucket:         testBucket,
+		Endpoint:       endpoint,
+		PublicURIs:     true,
+		MaxAttempts:    maxAttempts,
+		AttemptTimeout: attemptTimeout,
+		RetryDelay:     time.Millisecond,
+	}
+}
+
+func newFakeS3Uploader(endpoint string, maxAttempts int, attemptTimeout time.Duration) storage.Uploader {
+	return storage.NewS3Uploader(fakeS3Config(endpoint, maxAttempts, attemptTimeout))
+}
+
+func createFakeUpload(t *testing.T) string {
+	t.Helper()
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	t.Cleanup(func() { _ = os.Remove(f.Name()) })
+
+	return f.Name()
+}
+
+// objectKey cuts the object key from a public link to the fake bucket
+func objectKey(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+
+	return strings.TrimPrefix(u.Path, "/"+testBucket+"/")
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"foxyshot/storage/keytemplate"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// setHeaders adds Cache-Control, Content-Disposition and metadata from config to the request
+func (u *s3CompatibleUploader) setHeaders(input *s3.PutObjectInput, path string, vars keytemplate.Vars) error {
+	var err error
+	if input.CacheControl, err = u.headerValue(u.config.CacheControl, path, &vars); err != nil {
+		return err
+	}
+	if input.ContentDisposition, err = u.headerValue(u.config.ContentDisposition, path, &vars); err != nil {
+		return err
+	}
+
+	if len(u.config.Metadata) == 0 {
+		return nil
+	}
+	input.Metadata = make(map[string]*string, len(u.config.Metadata))
+	for name, tmplStr := range u.config.Metadata {
+		value, err := u.headerValue(tmplStr, path, &vars)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			input.Metadata[name] = value
+		}
+	}
+
+	return nil
+}
+
+// headerValue executes the template, nil means the header is not set
+func (u *s3CompatibleUploader) headerValue(tmplStr, path string, vars *keytemplate.Vars) (*string, error) {
+	if tmplStr == "" {
+		return nil, nil
+	}
+	tmpl, err := keytemplate.ParseValue(tmplStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.fillHash(tmpl, path, vars); err != nil {
+		return nil, err
+	}
+
+	value, err := tmpl.Execute(*vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return aws.String(value), nil
+}
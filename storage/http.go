@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"foxyshot/config"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxResponseSize limits how much of the response is read when looking for the link
+const maxResponseSize = 1 << 20
+
+// quoteEscaper is the same as the one mime/multipart uses for form field names
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+type httpUploader struct {
+	client *http.Client
+	config *config.HTTPConfig
+}
+
+// NewHTTPUploader creates new Uploader instances that send screenshots as multipart forms to a custom share service
+func NewHTTPUploader(config *config.HTTPConfig) Uploader {
+	return &httpUploader{client: &http.Client{}, config: config}
+}
+
+// Upload sends file to the configured endpoint and extracts the link from the response
+func (u *httpUploader) Upload(ctx context.Context, path string, _ UploadOptions) (Result, error) {
+	ft, err := detectFileType(path)
+	if err != nil {
+		return Result{}, fmt.Errorf("http upload error, %w", err)
+	}
+	key := generateObjectKey(ft.Ext)
+	body, contentType, err := u.buildForm(path, key, ft.ContentType)
+	if err != nil {
+		return Result{}, fmt.Errorf("http upload error, %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, u.config.Method, u.config.URL, body)
+	if err != nil {
+		return Result{}, fmt.Errorf("http upload error, %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for _, h := range u.config.Headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("http upload error, %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return Result{}, fmt.Errorf("http upload error, %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Result{}, fmt.Errorf("http upload error, unexpected status %s, response %q", resp.Status, truncate(respBody))
+	}
+
+	url, err := u.extractURL(respBody)
+	if err != nil {
+		return Result{}, fmt.Errorf("http upload error, %w, response %q", err, truncate(respBody))
+	}
+	log.Printf("Uploaded %s to %s \n", path, u.config.URL)
+
+	return Result{URL: url, Key: key}, nil
+}
+
+func (u *httpUploader) buildForm(path, filename, fileContentType string) (*bytes.Buffer, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for _, f := range u.config.Fields {
+		if err := w.WriteField(f.Name, f.Value); err != nil {
+			return nil, "", err
+		}
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(u.config.FileField), escapeQuotes(filename)))
+	header.Set("Content-Type", fileContentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body, w.FormDataContentType(), nil
+}
+
+func (u *httpUploader) extractURL(body []byte) (string, error) {
+	switch {
+	case u.config.URLPath != "":
+		return extractJSONPath(body, u.config.URLPath)
+	case u.config.URLRegexp != "":
+		return extractRegexp(body, u.config.URLRegexp)
+	default:
+		url := strings.TrimSpace(string(body))
+		if url == "" {
+			return "", fmt.Errorf("empty response")
+		}
+
+		return url, nil
+	}
+}
+
+// extractJSONPath supports dot separated keys with array indexes, e.g. $.files[0].url
+func extractJSONPath(body []byte, path string) (string, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("cannot parse response, %w", err)
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	for _, step := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			doc = node[step]
+		case []interface{}:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("no index %s in response", step)
+			}
+			doc = node[i]
+		default:
+			return "", fmt.Errorf("cannot find %s in response", step)
+		}
+	}
+
+	url, ok := doc.(string)
+	if !ok || url == "" {
+		return "", fmt.Errorf("no link at %s in response", path)
+	}
+
+	return url, nil
+}
+
+func extractRegexp(body []byte, expr string) (string, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", err
+	}
+	match := re.FindSubmatch(body)
+	if match == nil {
+		return "", fmt.Errorf("no match for %s in response", expr)
+	}
+	if len(match) > 1 {
+		return string(match[1]), nil
+	}
+
+	return string(match[0]), nil
+}
+
+func truncate(body []byte) string {
+	const limit = 200
+	if len(body) > limit {
+		return string(body[:limit]) + "..."
+	}
+
+	return string(body)
+}
@@ -0,0 +1,124 @@
+package storage_test
+
+import (
+	"context"
+	"foxyshot/config"
+	"foxyshot/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPUploader_Upload(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	tests := []struct {
+		name     string
+		response string
+		config   config.HTTPConfig
+		wantURL  string
+		wantErr  string
+	}{
+		{
+			name:     "plain text response",
+			response: "https://paste.example.com/abc\n",
+			wantURL:  "https://paste.example.com/abc",
+		},
+		{
+			name:     "json path",
+			response: `{"files": [{"url": "https://zipline.example.com/u/abc.jpg"}]}`,
+			config:   config.HTTPConfig{URLPath: "$.files[0].url"},
+			wantURL:  "https://zipline.example.com/u/abc.jpg",
+		},
+		{
+			name:     "regexp with group",
+			response: `<a href="https://xbackbone.example.com/abc">link</a>`,
+			config:   config.HTTPConfig{URLRegexp: `href="([^"]+)"`},
+			wantURL:  "https://xbackbone.example.com/abc",
+		},
+		{
+			name:     "regexp without group",
+			response: `uploaded to https://paste.example.com/abc, enjoy`,
+			config:   config.HTTPConfig{URLRegexp: `https://\S+/abc`},
+			wantURL:  "https://paste.example.com/abc",
+		},
+		{
+			name:     "missing json key",
+			response: `{"data": {}}`,
+			config:   config.HTTPConfig{URLPath: "data.url"},
+			wantErr:  `http upload error, no link at data.url in response, response "{\"data\": {}}"`,
+		},
+		{
+			name:     "no regexp match",
+			response: `error`,
+			config:   config.HTTPConfig{URLRegexp: `https://\S+`},
+			wantErr:  `http upload error, no match for https://\S+ in response, response "error"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPut, r.Method)
+				assert.Equal(t, "expected-token", r.Header.Get("Authorization"))
+				assert.Equal(t, "expected-value", r.FormValue("expectedField"))
+
+				file, header, err := r.FormFile("upload")
+				if !assert.NoError(t, err) {
+					w.WriteHeader(http.StatusBadRequest)
+
+					return
+				}
+				defer file.Close()
+				content, _ := io.ReadAll(file)
+				assert.Equal(t, uploadContent, string(content))
+				assert.NotEmpty(t, header.Filename)
+
+				_, _ = io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+
+			c := tt.config
+			c.URL = server.URL
+			c.Method = http.MethodPut
+			c.FileField = "upload"
+			c.Headers = []config.HTTPParam{{Name: "Authorization", Value: "expected-token"}}
+			c.Fields = []config.HTTPParam{{Name: "expectedField", Value: "expected-value"}}
+
+			uploaded, err := storage.NewHTTPUploader(&c).Upload(context.Background(), f.Name(), storage.UploadOptions{})
+			url := uploaded.URL
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantURL, url)
+		})
+	}
+}
+
+func TestHTTPUploader_UploadErrorStatus(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, "invalid token")
+	}))
+	defer server.Close()
+
+	uploader := storage.NewHTTPUploader(&config.HTTPConfig{URL: server.URL, Method: http.MethodPost, FileField: "file"})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.Empty(t, url)
+	assert.EqualError(t, err, `http upload error, unexpected status 403 Forbidden, response "invalid token"`)
+}
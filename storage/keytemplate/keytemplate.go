@@ -0,0 +1,246 @@
+package keytemplate
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default keeps keys unguessable, as they were before templates
+const Default = "{uuid}.{ext}"
+
+const (
+	defaultDateLayout = "2006-01-02"
+	shortIDLength     = 8
+	shortIDAlphabet   = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+var (
+	errEmpty  = errors.New("key template is empty")
+	errUnique = errors.New("key template must contain {uuid}, {shortid} or {hash}, otherwise uploads overwrite each other")
+)
+
+// Vars are the values for placeholders that depend on the uploaded file
+type Vars struct {
+	Time time.Time
+	// Hash of the file contents, only needed if the template uses {hash}
+	Hash string
+	// Path to the original screenshot
+	Original string
+	// Extension without a dot, e.g. jpg
+	Ext string
+}
+
+type part struct {
+	literal string
+	name    string
+	arg     string
+}
+
+// Template is a parsed key template, e.g. {date:2006/01/02}/{uuid}.{ext}
+type Template struct {
+	parts []part
+}
+
+// Parse checks the template for unknown placeholders and unbalanced braces
+func Parse(s string) (*Template, error) {
+	if s == "" {
+		return nil, errEmpty
+	}
+	if strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("key template %q must not start with /", s)
+	}
+
+	t, err := parse(s, "key template")
+	if err != nil {
+		return nil, err
+	}
+	if !t.Uses("uuid") && !t.Uses("shortid") && !t.Uses("hash") {
+		return nil, errUnique
+	}
+
+	return t, nil
+}
+
+// ParseValue parses templates for other values, e.g. headers, they do not need unique placeholders
+func ParseValue(s string) (*Template, error) {
+	return parse(s, "template")
+}
+
+func parse(s, kind string) (*Template, error) {
+	t := &Template{}
+	for rest := s; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("%s %q has unexpected }", kind, s)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%s %q has unclosed {", kind, s)
+		}
+
+		name, arg, _ := strings.Cut(rest[open+1:open+end], ":")
+		if err := validatePlaceholder(name, arg); err != nil {
+			return nil, fmt.Errorf("%s %q, %w", kind, s, err)
+		}
+		t.parts = append(t.parts, part{name: name, arg: arg})
+		rest = rest[open+end+1:]
+	}
+
+	return t, nil
+}
+
+func validatePlaceholder(name, arg string) error {
+	switch name {
+	case "date":
+		return nil
+	case "uuid", "shortid", "hash", "hostname", "user", "origname", "ext":
+		if arg != "" {
+			return fmt.Errorf("{%s} does not take arguments", name)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown placeholder {%s}", name)
+	}
+}
+
+// Uses reports whether the template contains the placeholder, e.g. to skip hashing files
+func (t *Template) Uses(name string) bool {
+	for _, p := range t.parts {
+		if p.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Prefix is the literal text before the first placeholder, all keys built from the template start with it
+func (t *Template) Prefix() string {
+	if len(t.parts) == 0 || t.parts[0].name != "" {
+		return ""
+	}
+
+	return t.parts[0].literal
+}
+
+// Execute builds the key
+func (t *Template) Execute(v Vars) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.name == "" {
+			b.WriteString(p.literal)
+
+			continue
+		}
+		val, err := p.value(v)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+	}
+
+	return b.String(), nil
+}
+
+func (p part) value(v Vars) (string, error) {
+	switch p.name {
+	case "date":
+		layout := p.arg
+		if layout == "" {
+			layout = defaultDateLayout
+		}
+
+		return v.Time.Format(layout), nil
+	case "uuid":
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return "", err
+		}
+
+		return id.String(), nil
+	case "shortid":
+		return shortID()
+	case "hash":
+		if v.Hash == "" {
+			return "", errors.New("no hash for {hash}")
+		}
+
+		return v.Hash, nil
+	case "hostname":
+		host, err := os.Hostname()
+		if err != nil {
+			return "", err
+		}
+
+		return sanitize(host), nil
+	case "user":
+		u, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+
+		return sanitize(u.Username), nil
+	case "origname":
+		base := filepath.Base(v.Original)
+		name := sanitize(strings.TrimSuffix(base, filepath.Ext(base)))
+		if v.Original == "" || name == "" {
+			return "screenshot", nil
+		}
+
+		return name, nil
+	case "ext":
+		return v.Ext, nil
+	default:
+		return "", fmt.Errorf("unknown placeholder {%s}", p.name)
+	}
+}
+
+func shortID() (string, error) {
+	alphabetSize := big.NewInt(int64(len(shortIDAlphabet)))
+	id := make([]byte, shortIDLength)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		id[i] = shortIDAlphabet[n.Int64()]
+	}
+
+	return string(id), nil
+}
+
+// sanitize keeps characters that are safe in urls, others are replaced with dashes
+func sanitize(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		safe := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-'
+		if safe {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.Trim(b.String(), "-")
+}
@@ -0,0 +1,117 @@
+package keytemplate
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		template string
+		errMsg   string
+	}{
+		{"", "key template is empty"},
+		{"/{uuid}", `key template "/{uuid}" must not start with /`},
+		{"{uuid", `key template "{uuid" has unclosed {`},
+		{"uuid}", `key template "uuid}" has unexpected }`},
+		{"{uuid}.{extension}", `key template "{uuid}.{extension}", unknown placeholder {extension}`},
+		{"{uuid:v4}", `key template "{uuid:v4}", {uuid} does not take arguments`},
+		{"{date}/{origname}.{ext}", "key template must contain {uuid}, {shortid} or {hash}, otherwise uploads overwrite each other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+
+			assert.Nil(t, tmpl)
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	hostname, _ := os.Hostname()
+	vars := Vars{
+		Time:     time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC),
+		Hash:     "expectedhash",
+		Original: "/Users/foxy/Desktop/Screenshot 2023-12-31 at 23.59.00.png",
+		Ext:      "png",
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{date:2006/01/02}/{hash}.{ext}", "2023/12/31/expectedhash.png"},
+		{"{date}-{hash}", "2023-12-31-expectedhash"},
+		{"{origname}-{hash}.{ext}", "Screenshot-2023-12-31-at-23.59.00-expectedhash.png"},
+		{"{hostname}/{hash}", sanitize(hostname) + "/expectedhash"},
+		{"{uuid}.{ext}", `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\.png$`},
+		{"s/{shortid}", `^s/[0-9a-zA-Z]{8}$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			require.NoError(t, err)
+
+			key, err := tmpl.Execute(vars)
+
+			assert.NoError(t, err)
+			if tt.want[0] == '^' {
+				assert.Regexp(t, regexp.MustCompile(tt.want), key)
+			} else {
+				assert.Equal(t, tt.want, key)
+			}
+		})
+	}
+}
+
+func TestTemplate_ExecuteWithoutOriginal(t *testing.T) {
+	tmpl, err := Parse("{origname}-{shortid}")
+	require.NoError(t, err)
+
+	key, err := tmpl.Execute(Vars{})
+
+	assert.NoError(t, err)
+	assert.Regexp(t, "^screenshot-[0-9a-zA-Z]{8}$", key)
+}
+
+func TestTemplate_Uses(t *testing.T) {
+	tmpl, err := Parse("{date:2006}/{hash}.{ext}")
+	require.NoError(t, err)
+
+	assert.True(t, tmpl.Uses("hash"))
+	assert.True(t, tmpl.Uses("date"))
+	assert.False(t, tmpl.Uses("uuid"))
+}
+
+func TestParseValue(t *testing.T) {
+	tmpl, err := ParseValue(`inline; filename="{origname}.{ext}"`)
+	require.NoError(t, err)
+
+	value, err := tmpl.Execute(Vars{Original: "/tmp/Screenshot 1.png", Ext: "jpg"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `inline; filename="Screenshot-1.jpg"`, value)
+
+	_, err = ParseValue("{time}")
+	assert.EqualError(t, err, `template "{time}", unknown placeholder {time}`)
+}
+
+func TestPrefix(t *testing.T) {
+	tests := map[string]string{
+		"screenshots/{date}/{uuid}.{ext}": "screenshots/",
+		"{date}/{uuid}.{ext}":             "",
+		"foxy-{shortid}":                  "foxy-",
+	}
+	for template, want := range tests {
+		tmpl, err := Parse(template)
+		require.NoError(t, err)
+
+		assert.Equal(t, want, tmpl.Prefix(), template)
+	}
+}
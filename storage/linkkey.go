@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"foxyshot/config"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// KeyFromURL maps a link built by a destination back to the key of the screenshot
+// CDN, public and presigned S3 links, viewer links of encrypted screenshots and links to local, webdav and sftp folders
+// are recognized, the query of presigned links is ignored. Only links of the destination are checked if it is set.
+// The name is empty for configs without destinations.
+func KeyFromURL(c *config.Config, destination, link string) (name, key string, ok bool) {
+	destinations := c.Destinations
+	if destination != "" || len(destinations) == 0 {
+		d, err := findDestination(c, destination)
+		if err != nil {
+			return "", "", false
+		}
+		destinations = []config.Destination{*d}
+	}
+
+	for i := range destinations {
+		d := &destinations[i]
+		if key, ok := keyFromURL(d, link); ok {
+			if len(c.Destinations) > 0 {
+				name = destinationName(d)
+			}
+
+			return name, key, true
+		}
+	}
+
+	return "", "", false
+}
+
+func keyFromURL(d *config.Destination, link string) (string, bool) {
+	link, fragment, _ := strings.Cut(link, "#")
+	// viewer links of encrypted screenshots have the object link in the fragment
+	if values, err := url.ParseQuery(fragment); err == nil && values.Get("u") != "" {
+		link, _, _ = strings.Cut(values.Get("u"), "#")
+	}
+	link, _, _ = strings.Cut(link, "?")
+
+	for _, base := range urlBases(d) {
+		if base == "" {
+			continue
+		}
+		rest, found := strings.CutPrefix(withoutScheme(link), withoutScheme(strings.TrimSuffix(base, "/"))+"/")
+		if !found || rest == "" {
+			continue
+		}
+		key, err := url.PathUnescape(rest)
+		if err != nil {
+			key = rest
+		}
+		if isS3(d) && key == viewerKeyOf(&d.S3) {
+			return "", false
+		}
+
+		return key, true
+	}
+
+	return "", false
+}
+
+// urlBases lists the prefixes the destination puts before keys in links
+func urlBases(d *config.Destination) []string {
+	var bases []string
+	switch {
+	case isS3(d):
+		if d.S3.CDN != "" {
+			bases = append(bases, d.S3.CDN)
+		}
+		if endpoint, err := s3Endpoint(&d.S3); err == nil {
+			bases = append(bases, endpoint+"/"+d.S3.Bucket)
+		}
+	case d.Backend == config.BackendLocal:
+		if d.Local.URL != "" {
+			bases = append(bases, d.Local.URL)
+		} else if abs, err := filepath.Abs(d.Local.Dir); err == nil {
+			bases = append(bases, "file://"+abs)
+		}
+	case d.Backend == config.BackendWebDAV:
+		if d.WebDAV.PublicURL != "" {
+			bases = append(bases, d.WebDAV.PublicURL)
+		}
+		bases = append(bases, d.WebDAV.URL)
+	case d.Backend == config.BackendSFTP:
+		bases = append(bases, d.SFTP.URL)
+	}
+
+	return bases
+}
+
+// s3Endpoint is the same endpoint as in generated links, it is resolved from the region if not set
+func s3Endpoint(c *config.S3Config) (string, error) {
+	if c.Endpoint != "" {
+		return endpoints.AddScheme(c.Endpoint, false), nil
+	}
+	resolved, err := endpoints.DefaultResolver().EndpointFor(s3.EndpointsID, c.Region)
+	if err != nil {
+		return "", err
+	}
+
+	return resolved.URL, nil
+}
+
+func isS3(d *config.Destination) bool {
+	return d.Backend == "" || d.Backend == config.BackendS3
+}
+
+// viewerKeyOf is the key of the viewer page, it is never deleted or linked by its link
+func viewerKeyOf(c *config.S3Config) string {
+	if c.ViewerKey != "" {
+		return c.ViewerKey
+	}
+
+	return defaultViewerKey
+}
+
+// withoutScheme lets http and https links match each other
+func withoutScheme(link string) string {
+	if _, rest, found := strings.Cut(link, "://"); found {
+		return rest
+	}
+
+	return link
+}
@@ -0,0 +1,82 @@
+package storage_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFromURL(t *testing.T) {
+	dir := t.TempDir()
+	c := &config.Config{Destinations: []config.Destination{
+		{Name: "cdn", S3: config.S3Config{Bucket: "shots", Endpoint: "https://s3.example.com", CDN: "https://cdn.example.com"}},
+		{Name: "public", S3: config.S3Config{Bucket: "public", Endpoint: "http://minio:9000"}},
+		{Name: "disk", Backend: config.BackendLocal, Local: config.LocalConfig{Dir: dir}},
+		{Name: "served", Backend: config.BackendLocal, Local: config.LocalConfig{Dir: "/srv/shots", URL: "https://shots.example.com/"}},
+		{Name: "dav", Backend: config.BackendWebDAV, WebDAV: config.WebDAVConfig{URL: "https://dav.example.com/remote/shots", PublicURL: "https://share.example.com/s"}},
+		{Name: "sftp", Backend: config.BackendSFTP, SFTP: config.SFTPConfig{URL: "https://files.example.com/shots"}},
+		{Name: "aws", S3: config.S3Config{Bucket: "archive", Region: "eu-west-1"}},
+	}}
+
+	tests := []struct {
+		name        string
+		destination string
+		link        string
+		wantName    string
+		wantKey     string
+		wantOK      bool
+	}{
+		{"cdn", "", "https://cdn.example.com/2024/shot.png", "cdn", "2024/shot.png", true},
+		{"endpoint and bucket", "", "https://s3.example.com/shots/shot.png", "cdn", "shot.png", true},
+		{"other scheme", "", "http://cdn.example.com/shot.png", "cdn", "shot.png", true},
+		{"presigned", "", "http://minio:9000/public/shot%20one.png?X-Amz-Expires=3600&X-Amz-Signature=abc", "public", "shot one.png", true},
+		{"viewer", "", "http://minio:9000/public/viewer.html#u=http%3A%2F%2Fminio%3A9000%2Fpublic%2Fshot.bin&k=secret", "public", "shot.bin", true},
+		{"viewer page", "", "http://minio:9000/public/viewer.html", "", "", false},
+		{"local file", "", "file://" + filepath.Join(dir, "shot.png"), "disk", "shot.png", true},
+		{"local url", "", "https://shots.example.com/shot.png", "served", "shot.png", true},
+		{"webdav public url", "", "https://share.example.com/s/shot.png", "dav", "shot.png", true},
+		{"webdav url", "", "https://dav.example.com/remote/shots/shot.png", "dav", "shot.png", true},
+		{"sftp", "", "https://files.example.com/shots/shot.png", "sftp", "shot.png", true},
+		{"endpoint from region", "", "https://s3.eu-west-1.amazonaws.com/archive/shot.png", "aws", "shot.png", true},
+		{"named destination", "sftp", "https://files.example.com/shots/shot.png", "sftp", "shot.png", true},
+		{"other destination", "dav", "https://files.example.com/shots/shot.png", "", "", false},
+		{"unknown destination", "missing", "https://files.example.com/shots/shot.png", "", "", false},
+		{"base without key", "", "https://cdn.example.com/", "", "", false},
+		{"other host", "", "https://example.org/shot.png", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, key, ok := storage.KeyFromURL(c, tt.destination, tt.link)
+
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantKey, key)
+		})
+	}
+}
+
+func TestKeyFromURL_SingleDestination(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.PublicURIs = false
+	s3Config.Duration = time.Hour
+	uploaded, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+	require.NoError(t, err)
+
+	c := &config.Config{Destination: config.Destination{S3: *s3Config}}
+	name, key, ok := storage.KeyFromURL(c, "", uploaded.URL)
+
+	require.True(t, ok)
+	assert.Empty(t, name, "configs without destinations have no names")
+	assert.Equal(t, uploaded.Key, key)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"foxyshot/config"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type localUploader struct {
+	config *config.LocalConfig
+}
+
+// NewLocalUploader creates new Uploader instances that copy screenshots into a local folder
+func NewLocalUploader(config *config.LocalConfig) Uploader {
+	return &localUploader{config: config}
+}
+
+// Upload copies file into the configured folder and returns its url
+func (u *localUploader) Upload(_ context.Context, path string, _ UploadOptions) (Result, error) {
+	if err := os.MkdirAll(u.config.Dir, 0755); err != nil {
+		return Result{}, fmt.Errorf("local storage error, %w", err)
+	}
+
+	ft, err := detectFileType(path)
+	if err != nil {
+		return Result{}, fmt.Errorf("local storage error, %w", err)
+	}
+	key := generateObjectKey(ft.Ext)
+	dest := filepath.Join(u.config.Dir, key)
+	if err := copyFile(path, dest); err != nil {
+		return Result{}, fmt.Errorf("local storage error, %w", err)
+	}
+	log.Printf("Copied %s to %s \n", path, dest)
+
+	url, err := u.generateURL(key, dest)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{URL: url, Key: key}, nil
+}
+
+// Delete removes the copy from the folder
+func (u *localUploader) Delete(_ context.Context, key string) error {
+	if key == "" || filepath.Base(key) != key {
+		return fmt.Errorf("local storage error, invalid key %q", key)
+	}
+	err := os.Remove(filepath.Join(u.config.Dir, key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("local storage error, %w", err)
+	}
+
+	return nil
+}
+
+func (u *localUploader) generateURL(key, dest string) (string, error) {
+	if u.config.URL != "" {
+		return strings.TrimSuffix(u.config.URL, "/") + "/" + key, nil
+	}
+
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return "", fmt.Errorf("local storage error, %w", err)
+	}
+
+	return "file://" + abs, nil
+}
+
+func copyFile(src, dest string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+
+	return err
+}
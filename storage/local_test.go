@@ -0,0 +1,58 @@
+package storage_test
+
+import (
+	"context"
+	"foxyshot/config"
+	"foxyshot/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalUploader_Upload(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	dir := t.TempDir()
+	uploader := storage.NewLocalUploader(&config.LocalConfig{Dir: dir, URL: "https://example.com/shots/"})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, "https://example.com/shots/"), url)
+
+	assert.Equal(t, "https://example.com/shots/"+uploaded.Key, url)
+
+	copied, err := os.ReadFile(filepath.Join(dir, uploaded.Key))
+	assert.NoError(t, err)
+	assert.Equal(t, uploadContent, string(copied))
+}
+
+func TestLocalUploader_UploadWithoutURL(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	dir := filepath.Join(t.TempDir(), "nested")
+	uploader := storage.NewLocalUploader(&config.LocalConfig{Dir: dir})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, "file://"+dir+"/"), url)
+	assert.FileExists(t, strings.TrimPrefix(url, "file://"))
+}
+
+func TestLocalUploader_UploadMissingFile(t *testing.T) {
+	uploader := storage.NewLocalUploader(&config.LocalConfig{Dir: t.TempDir()})
+
+	uploaded, err := uploader.Upload(context.Background(), "doesnotexist", storage.UploadOptions{})
+	url := uploaded.URL
+
+	assert.Empty(t, url)
+	assert.ErrorContains(t, err, "local storage error")
+}
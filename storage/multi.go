@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namedUploader is an Uploader with a name for logs and errors, errors are not wrapped without a name
+// Each attempt is limited by timeout if it is set
+type namedUploader struct {
+	Uploader
+	name    string
+	timeout time.Duration
+}
+
+// Upload tags the result with the name of the destination
+func (u namedUploader) Upload(ctx context.Context, path string, opts UploadOptions) (Result, error) {
+	if u.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.timeout)
+		defer cancel()
+	}
+
+	r, err := u.Uploader.Upload(ctx, path, opts)
+	if err != nil && u.name == "" {
+		return Result{}, err
+	}
+	if err != nil {
+		return Result{}, &DestinationError{Destination: u.name, Err: err}
+	}
+	r.Destination = u.name
+
+	return r, nil
+}
+
+// DestinationError is an upload error of a single destination
+type DestinationError struct {
+	Destination string
+	Err         error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Destination, e.Err)
+}
+
+func (e *DestinationError) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is returned when the screenshot was not uploaded to every destination
+// Upload still returns a link if at least one destination succeeded
+type PartialError struct {
+	Failed []*DestinationError
+	Total  int
+}
+
+func (e *PartialError) Error() string {
+	failed := make([]string, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		failed = append(failed, f.Error())
+	}
+
+	return fmt.Sprintf("%d of %d destinations failed, %s", len(e.Failed), e.Total, strings.Join(failed, "; "))
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		errs = append(errs, f)
+	}
+
+	return errs
+}
+
+// multiUploader uploads screenshots to all destinations in parallel
+type multiUploader struct {
+	destinations []namedUploader
+	primary      int
+}
+
+func newMultiUploader(destinations []namedUploader, primary int) *multiUploader {
+	return &multiUploader{destinations: destinations, primary: primary}
+}
+
+// Upload returns the link from the primary destination, or from the first successful one if the primary failed
+// If some destinations failed, the link is returned together with a *PartialError
+func (u *multiUploader) Upload(ctx context.Context, path string, opts UploadOptions) (Result, error) {
+	results := make([]Result, len(u.destinations))
+	errs := make([]error, len(u.destinations))
+
+	var wg sync.WaitGroup
+	for i, d := range u.destinations {
+		wg.Add(1)
+		go func(i int, d namedUploader) {
+			defer wg.Done()
+			results[i], errs[i] = d.Upload(ctx, path, opts)
+		}(i, d)
+	}
+	wg.Wait()
+
+	partial := &PartialError{Total: len(u.destinations)}
+	for _, err := range errs {
+		var destErr *DestinationError
+		if errors.As(err, &destErr) {
+			partial.Failed = append(partial.Failed, destErr)
+		}
+	}
+
+	picked, ok := u.pick(errs)
+	if !ok {
+		return Result{}, partial
+	}
+	r := results[picked]
+	for i, err := range errs {
+		if err == nil && i != picked {
+			r.Copies = append(r.Copies, results[i])
+		}
+	}
+	if len(partial.Failed) == 0 {
+		return r, nil
+	}
+	log.Printf("Uploaded %s with failures: %v \n", path, partial)
+
+	return r, partial
+}
+
+// pick returns the index of the result with the link
+func (u *multiUploader) pick(errs []error) (int, bool) {
+	if errs[u.primary] == nil {
+		return u.primary, true
+	}
+	for i, err := range errs {
+		if err == nil {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
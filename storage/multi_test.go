@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiUploader_Upload(t *testing.T) {
+	errExpected := errors.New("expected error")
+
+	tests := []struct {
+		name        string
+		results     []mockResult
+		primary     int
+		wantURL     string
+		wantCopies  []string
+		wantFailed  []string
+		wantPartial bool
+	}{
+		{
+			name:       "all succeeded, primary link",
+			results:    []mockResult{{url: "first"}, {url: "second"}},
+			primary:    1,
+			wantURL:    "second",
+			wantCopies: []string{"first"},
+		},
+		{
+			name:        "primary failed, first successful link",
+			results:     []mockResult{{err: errExpected}, {url: "second"}, {url: "third"}},
+			wantURL:     "second",
+			wantCopies:  []string{"third"},
+			wantFailed:  []string{"mock0"},
+			wantPartial: true,
+		},
+		{
+			name:        "secondary failed",
+			results:     []mockResult{{url: "first"}, {err: errExpected}},
+			wantURL:     "first",
+			wantFailed:  []string{"mock1"},
+			wantPartial: true,
+		},
+		{
+			name:        "all failed",
+			results:     []mockResult{{err: errExpected}, {err: errExpected}},
+			wantFailed:  []string{"mock0", "mock1"},
+			wantPartial: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mocks := make([]*mockUploader, 0, len(tt.results))
+			destinations := make([]namedUploader, 0, len(tt.results))
+			for i, r := range tt.results {
+				m := &mockUploader{result: r}
+				mocks = append(mocks, m)
+				destinations = append(destinations, namedUploader{name: "mock" + string(rune('0'+i)), Uploader: m})
+			}
+
+			uploaded, err := newMultiUploader(destinations, tt.primary).Upload(context.Background(), "expected-path", UploadOptions{})
+			url := uploaded.URL
+
+			assert.Equal(t, tt.wantURL, url)
+			var copies []string
+			for _, c := range uploaded.Copies {
+				copies = append(copies, c.URL)
+			}
+			assert.Equal(t, tt.wantCopies, copies)
+			for _, m := range mocks {
+				assert.Equal(t, "expected-path", m.pathUploaded)
+			}
+			if !tt.wantPartial {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			var partial *PartialError
+			assert.ErrorAs(t, err, &partial)
+			assert.ErrorIs(t, err, errExpected)
+			assert.Equal(t, len(tt.results), partial.Total)
+			failed := make([]string, 0, len(partial.Failed))
+			for _, f := range partial.Failed {
+				failed = append(failed, f.Destination)
+			}
+			assert.Equal(t, tt.wantFailed, failed)
+		})
+	}
+}
+
+func TestPartialError_Error(t *testing.T) {
+	err := &PartialError{
+		Failed: []*DestinationError{{Destination: "s3", Err: errors.New("timeout")}},
+		Total:  2,
+	}
+
+	assert.EqualError(t, err, "1 of 2 destinations failed, s3: timeout")
+}
+
+func TestNamedUploader_UploadWithoutName(t *testing.T) {
+	errExpected := errors.New("expected error")
+	u := namedUploader{timeout: time.Minute, Uploader: &mockUploader{result: mockResult{err: errExpected}}}
+
+	_, err := u.Upload(context.Background(), "expected-path", UploadOptions{})
+
+	assert.Equal(t, errExpected, err, "a single destination has no name to prefix errors with")
+}
+
+type mockResult struct {
+	url string
+	err error
+}
+
+type mockUploader struct {
+	mu           sync.Mutex
+	result       mockResult
+	pathUploaded string
+}
+
+func (m *mockUploader) Upload(_ context.Context, path string, _ UploadOptions) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pathUploaded = path
+
+	return Result{URL: m.result.url}, m.result.err
+}
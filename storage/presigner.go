@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"foxyshot/config"
+)
+
+// ErrPresignNotSupported is returned for destinations without expiring links
+var ErrPresignNotSupported = errors.New("links cannot be regenerated")
+
+// Presigner is implemented by uploaders with expiring links
+type Presigner interface {
+	// Presign creates a new link to the uploaded file, the configured duration is used if duration is zero
+	// previous is the old link, encrypted screenshots can only be opened with the key in it
+	Presign(ctx context.Context, key, previous string, duration time.Duration) (Result, error)
+}
+
+// NewPresigner creates the Presigner for the destination with the name, the top-level destination is used if it is empty
+func NewPresigner(c *config.Config, destination string) (Presigner, error) {
+	u, name, err := destinationUploader(c, destination)
+	if err != nil {
+		return nil, err
+	}
+	presigner, ok := u.(Presigner)
+	if !ok {
+		return nil, fmt.Errorf("%s, %w", name, ErrPresignNotSupported)
+	}
+
+	return presigner, nil
+}
@@ -0,0 +1,162 @@
+package storage_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Uploader_LinkDurations(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.PublicURIs = false
+	s3Config.Duration = 24 * time.Hour
+	s3Config.LinkDurations = []config.LinkDuration{
+		{Suffix: "-share", Duration: 168 * time.Hour},
+		{Folder: "/Desktop/Screenshots/quick", Duration: time.Hour},
+	}
+	u := storage.NewS3Uploader(s3Config)
+	file := createFakeUpload(t)
+
+	tests := []struct {
+		source      string
+		wantExpires string
+	}{
+		{"/Desktop/Screenshots/Screenshot-share.png", "604800"},
+		{"/Desktop/Screenshots/Screenshot-share", "604800"},
+		{"/Desktop/Screenshots/quick/Screenshot.png", "3600"},
+		{"/Desktop/Screenshots/quick/nested/Screenshot.png", "3600"},
+		{"/Desktop/Screenshots/quicker/Screenshot.png", "86400"},
+		{"", "86400"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			uploaded, err := u.Upload(context.Background(), file, storage.UploadOptions{Source: tt.source})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantExpires, linkQuery(t, uploaded.URL).Get("X-Amz-Expires"))
+			assert.WithinDuration(t, time.Now().Add(linkDuration(t, uploaded.URL)), uploaded.Expires, time.Minute)
+		})
+	}
+}
+
+func TestS3Uploader_Presign(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.store("2023/shot.png", "shot", time.Now())
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.PublicURIs = false
+	s3Config.Duration = 24 * time.Hour
+	presigner, ok := storage.NewS3Uploader(s3Config).(storage.Presigner)
+	require.True(t, ok)
+
+	renewed, err := presigner.Presign(context.Background(), "2023/shot.png", "", 72*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "2023/shot.png", renewed.Key)
+	assert.True(t, strings.HasPrefix(renewed.URL, server.URL+"/"+testBucket+"/2023/shot.png?"), renewed.URL)
+	assert.Equal(t, "259200", linkQuery(t, renewed.URL).Get("X-Amz-Expires"))
+
+	configured, err := presigner.Presign(context.Background(), "2023/shot.png", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "86400", linkQuery(t, configured.URL).Get("X-Amz-Expires"))
+}
+
+func TestS3Uploader_PresignMissing(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.PublicURIs = false
+	_, err := storage.NewS3Uploader(s3Config).(storage.Presigner).Presign(context.Background(), "2023/shot.png", "", time.Hour)
+
+	assert.EqualError(t, err, "2023/shot.png does not exist in "+testBucket+", it was deleted")
+}
+
+func TestS3Uploader_PresignRetention(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.store("shots/new.png", "new", time.Now().Add(-time.Hour))
+	fake.store("shots/old.png", "old", time.Now().Add(-48*time.Hour))
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.PublicURIs = false
+	s3Config.Retention = 24 * time.Hour
+	presigner := storage.NewS3Uploader(s3Config).(storage.Presigner)
+
+	renewed, err := presigner.Presign(context.Background(), "shots/new.png", "", 72*time.Hour)
+	require.NoError(t, err)
+	assert.InDelta(t, 23*time.Hour, linkDuration(t, renewed.URL), float64(time.Minute), "the link expires with the screenshot")
+	assert.WithinDuration(t, time.Now().Add(23*time.Hour), renewed.Expires, time.Minute)
+
+	_, err = presigner.Presign(context.Background(), "shots/old.png", "", time.Hour)
+	assert.EqualError(t, err, "shots/old.png is older than retention 24h0m0s and will be deleted")
+}
+
+func TestS3Uploader_PresignEncrypted(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.PublicURIs = false
+	s3Config.Duration = time.Hour
+	s3Config.Encrypt = true
+	u := storage.NewS3Uploader(s3Config)
+	uploaded, err := u.Upload(context.Background(), "../imageprocessing/testdata/valid.png", storage.UploadOptions{})
+	require.NoError(t, err)
+
+	renewed, err := u.(storage.Presigner).Presign(context.Background(), uploaded.Key, uploaded.URL, 48*time.Hour)
+	require.NoError(t, err)
+
+	_, oldFragment, _ := strings.Cut(uploaded.URL, "#")
+	viewerURL, newFragment, _ := strings.Cut(renewed.URL, "#")
+	assert.Equal(t, "172800", linkQuery(t, viewerURL).Get("X-Amz-Expires"), "the viewer link is renewed too")
+	previous, err := url.ParseQuery(oldFragment)
+	require.NoError(t, err)
+	params, err := url.ParseQuery(newFragment)
+	require.NoError(t, err)
+	assert.Equal(t, previous.Get("k"), params.Get("k"))
+	assert.Equal(t, "image/png", params.Get("t"))
+	assert.Equal(t, "172800", linkQuery(t, params.Get("u")).Get("X-Amz-Expires"))
+
+	_, err = u.(storage.Presigner).Presign(context.Background(), uploaded.Key, "", time.Hour)
+	assert.EqualError(t, err, "the screenshot is encrypted, the key is only in the link saved in history")
+}
+
+func TestNewPresigner(t *testing.T) {
+	c := &config.Config{Destination: config.Destination{Backend: config.BackendLocal, Local: config.LocalConfig{Dir: t.TempDir()}}}
+
+	_, err := storage.NewPresigner(c, "")
+
+	assert.ErrorIs(t, err, storage.ErrPresignNotSupported)
+	assert.EqualError(t, err, "local, links cannot be regenerated")
+}
+
+func linkQuery(t *testing.T, link string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+
+	return parsed.Query()
+}
+
+func linkDuration(t *testing.T, link string) time.Duration {
+	t.Helper()
+	d, err := time.ParseDuration(linkQuery(t, link).Get("X-Amz-Expires") + "s")
+	require.NoError(t, err)
+
+	return d
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// permanentS3Codes are errors that will not go away by retrying, e.g. wrong credentials
+var permanentS3Codes = map[string]bool{
+	"AccessDenied":          true,
+	"InvalidAccessKeyId":    true,
+	"SignatureDoesNotMatch": true,
+	"NoSuchBucket":          true,
+	"InvalidBucketName":     true,
+	"NoCredentialProviders": true,
+}
+
+// putObject uploads the object making up to MaxAttempts attempts, each limited by AttemptTimeout
+func (u *s3CompatibleUploader) putObject(ctx context.Context, input *s3.PutObjectInput, body io.ReadSeeker) (*s3.PutObjectOutput, error) {
+	attempts := u.config.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		output, err := u.putObjectAttempt(ctx, input)
+		if err == nil {
+			return output, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || !isRetryableS3Error(err) {
+			return nil, err
+		}
+
+		delay := backoff(u.config.RetryDelay, attempt)
+		log.Printf("Upload attempt %d of %d failed, retrying in %s: %v \n", attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (u *s3CompatibleUploader) putObjectAttempt(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if u.config.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.config.AttemptTimeout)
+		defer cancel()
+	}
+
+	// attempts are retried by putObject, other requests keep the SDK retries
+	return u.client.PutObjectWithContext(ctx, input, func(r *request.Request) {
+		r.Retryer = client.NoOpRetryer{}
+	})
+}
+
+// isRetryableS3Error tells temporary failures (network errors, timeouts, throttling, 5xx) from permanent ones
+func isRetryableS3Error(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && permanentS3Codes[awsErr.Code()] {
+		return false
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() != 0 {
+		status := reqErr.StatusCode()
+
+		return status >= http.StatusInternalServerError ||
+			status == http.StatusTooManyRequests ||
+			status == http.StatusRequestTimeout ||
+			reqErr.Code() == "RequestTimeout" ||
+			reqErr.Code() == "SlowDown"
+	}
+
+	return true
+}
+
+// backoff doubles the delay for every attempt and picks a random duration in [delay/2, delay]
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base << (attempt - 1)
+	if delay <= 0 || delay > time.Hour { // overflow or unreasonable delays
+		delay = time.Hour
+	}
+	half := int64(delay / 2)
+
+	return time.Duration(half + rand.Int63n(half+1))
+}
@@ -0,0 +1,118 @@
+package storage_test
+
+import (
+	"context"
+	"foxyshot/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Uploader_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     []int
+		maxAttempts  int
+		wantAttempts int
+		wantErr      string
+	}{
+		{
+			name:         "success after temporary failures",
+			failures:     []int{http.StatusServiceUnavailable, http.StatusInternalServerError},
+			maxAttempts:  3,
+			wantAttempts: 3,
+		},
+		{
+			name:         "throttling is retried",
+			failures:     []int{http.StatusTooManyRequests},
+			maxAttempts:  3,
+			wantAttempts: 2,
+		},
+		{
+			name:         "gives up after max attempts",
+			failures:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			maxAttempts:  2,
+			wantAttempts: 2,
+			wantErr:      "ServiceUnavailable",
+		},
+		{
+			name:         "auth failures are not retried",
+			failures:     []int{http.StatusForbidden},
+			maxAttempts:  3,
+			wantAttempts: 1,
+			wantErr:      "AccessDenied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeS3{failures: tt.failures}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			uploader := newFakeS3Uploader(server.URL, tt.maxAttempts, 0)
+			uploaded, err := uploader.Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+
+			assert.Equal(t, tt.wantAttempts, fake.attempts())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Empty(t, uploaded.URL)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uploadContent, fake.lastBody, "every attempt must send the whole file")
+		})
+	}
+}
+
+func TestS3Uploader_DeleteKeepsSDKRetries(t *testing.T) {
+	deletes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deletes++
+		if deletes == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	deleter := newFakeS3Uploader(server.URL, 1, 0).(storage.Deleter)
+
+	assert.NoError(t, deleter.Delete(context.Background(), "shot.png"))
+	assert.Equal(t, 2, deletes, "only uploads are retried by the uploader")
+}
+
+func TestS3Uploader_AttemptTimeout(t *testing.T) {
+	fake := &fakeS3{delays: []time.Duration{time.Second}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	uploader := newFakeS3Uploader(server.URL, 2, 50*time.Millisecond)
+	uploaded, err := uploader.Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, uploaded.URL)
+	assert.Equal(t, 2, fake.attempts())
+}
+
+func TestS3Uploader_CancelledDuringBackoff(t *testing.T) {
+	fake := &fakeS3{failures: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 3, 0)
+	s3Config.RetryDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := storage.NewS3Uploader(s3Config).Upload(ctx, createFakeUpload(t), storage.UploadOptions{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, fake.attempts())
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"foxyshot/config"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type sftpUploader struct {
+	config *config.SFTPConfig
+}
+
+// NewSFTPUploader creates new Uploader instances that copy screenshots over SSH
+func NewSFTPUploader(config *config.SFTPConfig) Uploader {
+	return &sftpUploader{config: config}
+}
+
+// Upload copies file into the remote folder and returns its url
+func (u *sftpUploader) Upload(ctx context.Context, filePath string, _ UploadOptions) (Result, error) {
+	client, closeClient, err := u.connect(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("sftp error, %w", err)
+	}
+	defer closeClient()
+
+	ft, err := detectFileType(filePath)
+	if err != nil {
+		return Result{}, fmt.Errorf("sftp error, %w", err)
+	}
+	key := generateObjectKey(ft.Ext)
+	remotePath := path.Join(u.config.Dir, key)
+	if err := uploadRemoteFile(client, filePath, remotePath); err != nil {
+		return Result{}, fmt.Errorf("sftp error, %w", abortedError(ctx, err))
+	}
+	log.Printf("Uploaded %s to %s:%s \n", filePath, u.config.Host, remotePath)
+
+	return Result{URL: joinURL(u.config.URL, key), Key: key}, nil
+}
+
+// Delete removes the file from the remote folder
+func (u *sftpUploader) Delete(ctx context.Context, key string) error {
+	client, closeClient, err := u.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("sftp error, %w", err)
+	}
+	defer closeClient()
+
+	err = client.Remove(path.Join(u.config.Dir, key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("sftp error, %w", abortedError(ctx, err))
+	}
+
+	return nil
+}
+
+func uploadRemoteFile(client *sftp.Client, local, remote string) (err error) {
+	in, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := client.MkdirAll(path.Dir(remote)); err != nil {
+		return err
+	}
+	out, err := client.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+
+	return err
+}
+
+// connect opens an sftp session, the connection is closed when ctx is done until closeClient is called,
+// so hung transfers are aborted as well as the handshake
+func (u *sftpUploader) connect(ctx context.Context) (client *sftp.Client, closeClient func(), err error) {
+	conn, stop, err := u.dial(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err = sftp.NewClient(conn)
+	if err != nil {
+		stop()
+		conn.Close()
+
+		return nil, nil, abortedError(ctx, err)
+	}
+
+	return client, func() {
+		client.Close()
+		stop()
+		conn.Close()
+	}, nil
+}
+
+// abortedError reports the cancelled context instead of the error of the closed connection
+func abortedError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (u *sftpUploader) dial(ctx context.Context) (*ssh.Client, func() bool, error) {
+	hostKeyCallback, err := knownhosts.New(u.config.KnownHosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read known hosts, %w", err)
+	}
+	auth, closeAuth, err := u.authMethod()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeAuth()
+	clientConfig := &ssh.ClientConfig{
+		User:            u.config.Username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	addr := u.config.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// ssh and sftp do not accept a context, closing the connection aborts them
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+
+	c, chans, reqs, err := ssh.NewClientConn(netConn, addr, clientConfig)
+	if err != nil {
+		stop()
+		netConn.Close()
+
+		return nil, nil, abortedError(ctx, err)
+	}
+
+	return ssh.NewClient(c, chans, reqs), stop, nil
+}
+
+// authMethod returns key based auth and a function releasing its resources once the handshake is over
+func (u *sftpUploader) authMethod() (ssh.AuthMethod, func(), error) {
+	if u.config.KeyFile == "" {
+		return agentAuth()
+	}
+
+	pem, err := os.ReadFile(u.config.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read key file, %w", err)
+	}
+	var signer ssh.Signer
+	if u.config.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(u.config.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse key file, %w", err)
+	}
+
+	return ssh.PublicKeys(signer), func() {}, nil
+}
+
+// agentAuth uses keys from ssh-agent listening on SSH_AUTH_SOCK
+func agentAuth() (ssh.AuthMethod, func(), error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, fmt.Errorf("no key file configured and SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to ssh-agent, %w", err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), func() { conn.Close() }, nil
+}
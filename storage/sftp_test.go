@@ -0,0 +1,240 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"foxyshot/config"
+	"foxyshot/storage"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSFTPUploader_UploadWithKeyFile(t *testing.T) {
+	server := startSSHServer(t)
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	remoteDir := filepath.Join(t.TempDir(), "www", "shots")
+	uploader := storage.NewSFTPUploader(&config.SFTPConfig{
+		Host:       server.addr,
+		Username:   testUser,
+		KeyFile:    server.clientKeyFile,
+		KnownHosts: server.knownHosts,
+		Dir:        remoteDir,
+		URL:        "https://example.com/shots",
+	})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, "https://example.com/shots/"), url)
+
+	content, err := os.ReadFile(filepath.Join(remoteDir, strings.TrimPrefix(url, "https://example.com/shots/")))
+	assert.NoError(t, err)
+	assert.Equal(t, uploadContent, string(content))
+}
+
+func TestSFTPUploader_UploadWithAgent(t *testing.T) {
+	server := startSSHServer(t)
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: server.clientKey}))
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = agent.ServeAgent(keyring, conn) }()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	uploader := storage.NewSFTPUploader(&config.SFTPConfig{
+		Host:       server.addr,
+		Username:   testUser,
+		KnownHosts: server.knownHosts,
+		Dir:        t.TempDir(),
+		URL:        "https://example.com",
+	})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(url, "https://example.com/"), url)
+}
+
+func TestSFTPUploader_UploadUnknownHost(t *testing.T) {
+	server := startSSHServer(t)
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	otherKnownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, err := ssh.NewPublicKey(otherKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(otherKnownHosts, []byte(knownhosts.Line([]string{server.addr}, otherPub)+"\n"), 0600))
+
+	uploader := storage.NewSFTPUploader(&config.SFTPConfig{
+		Host:       server.addr,
+		Username:   testUser,
+		KeyFile:    server.clientKeyFile,
+		KnownHosts: otherKnownHosts,
+		Dir:        t.TempDir(),
+	})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.Empty(t, url)
+	assert.ErrorContains(t, err, "knownhosts: key mismatch")
+}
+
+func TestSFTPUploader_UploadTimeout(t *testing.T) {
+	// the server accepts the session but never answers sftp requests
+	server := startSSHServerWith(t, func(channel ssh.Channel) { _, _ = io.Copy(io.Discard, channel) })
+	f, err := createUploadFile(uploadContent)
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	uploader := storage.NewSFTPUploader(&config.SFTPConfig{
+		Host:       server.addr,
+		Username:   testUser,
+		KeyFile:    server.clientKeyFile,
+		KnownHosts: server.knownHosts,
+		Dir:        t.TempDir(),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = uploader.Upload(ctx, f.Name(), storage.UploadOptions{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+type sshServer struct {
+	addr          string
+	knownHosts    string
+	clientKey     ed25519.PrivateKey
+	clientKeyFile string
+}
+
+// startSSHServer runs an in-process SSH server with the sftp subsystem serving the local filesystem
+func startSSHServer(t *testing.T) *sshServer {
+	t.Helper()
+
+	return startSSHServerWith(t, serveSFTP)
+}
+
+// startSSHServerWith runs an in-process SSH server that handles the sftp subsystem with subsystem
+func startSSHServerWith(t *testing.T, subsystem func(channel ssh.Channel)) *sshServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	clientPub, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authorized, err := ssh.NewPublicKey(clientPub)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	require.NoError(t, err)
+	clientKeyFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(clientKeyFile, pem.EncodeToMemory(block), 0600))
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == testUser && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return &ssh.Permissions{}, nil
+			}
+
+			return nil, assert.AnError
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, serverConfig, subsystem)
+		}
+	}()
+
+	addr := l.Addr().String()
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{addr}, hostSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+
+	return &sshServer{addr: addr, knownHosts: knownHosts, clientKey: clientKey, clientKeyFile: clientKeyFile}
+}
+
+func serveSSH(conn net.Conn, serverConfig *ssh.ServerConfig, subsystem func(channel ssh.Channel)) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					subsystem(channel)
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+func serveSFTP(channel ssh.Channel) {
+	server, err := sftp.NewServer(channel)
+	if err != nil {
+		return
+	}
+	_ = server.Serve()
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/storage/keytemplate"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// deleteBatchSize is the most keys DeleteObjects accepts in one request
+const deleteBatchSize = 1000
+
+// Sweeper deletes screenshots older than the retention period from the bucket
+type Sweeper struct {
+	client *s3.S3
+	config *config.S3Config
+	// onSwept gets the deleted keys, e.g. to mark them in history, it may be nil
+	onSwept func(keys []string)
+}
+
+// NewSweepers creates sweepers for S3 destinations with retention set
+func NewSweepers(c *config.Config, onSwept func(keys []string)) []*Sweeper {
+	destinations := c.Destinations
+	if len(destinations) == 0 {
+		destinations = []config.Destination{c.Destination}
+	}
+
+	var sweepers []*Sweeper
+	for i := range destinations {
+		d := &destinations[i]
+		if (d.Backend == "" || d.Backend == config.BackendS3) && d.S3.Retention > 0 {
+			sweepers = append(sweepers, NewSweeper(&d.S3, onSwept))
+		}
+	}
+
+	return sweepers
+}
+
+// NewSweeper creates a Sweeper for the bucket
+func NewSweeper(config *config.S3Config, onSwept func(keys []string)) *Sweeper {
+	return &Sweeper{client: newS3Client(config), config: config, onSwept: onSwept}
+}
+
+// Run sweeps the bucket right away and then every SweepInterval until ctx is done
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.Sweep(ctx, time.Now())
+		if len(deleted) > 0 {
+			log.Printf("Deleted %d screenshots older than %s from %s \n", len(deleted), s.config.Retention, s.config.Bucket)
+			if s.onSwept != nil {
+				s.onSwept(deleted)
+			}
+		}
+		if err != nil {
+			log.Printf("Cannot delete old screenshots from %s, %v \n", s.config.Bucket, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes objects under the prefix that were uploaded before now minus Retention and returns their keys
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) ([]string, error) {
+	prefix, err := s.prefix()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.Add(-s.config.Retention)
+	viewer := viewerKeyOf(s.config)
+
+	var expired []string
+	input := s3.ListObjectsV2Input{Bucket: aws.String(s.config.Bucket), Prefix: aws.String(prefix)}
+	err = s.client.ListObjectsV2PagesWithContext(ctx, &input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			if key != viewer && obj.LastModified != nil && obj.LastModified.Before(cutoff) {
+				expired = append(expired, key)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing objects, %w", err)
+	}
+
+	var deleted []string
+	for start := 0; start < len(expired); start += deleteBatchSize {
+		batch, err := s.deleteObjects(ctx, expired[start:min(start+deleteBatchSize, len(expired))])
+		deleted = append(deleted, batch...)
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// deleteObjects deletes the keys with a single request and returns the deleted ones
+func (s *Sweeper) deleteObjects(ctx context.Context, keys []string) ([]string, error) {
+	objects := make([]*s3.ObjectIdentifier, 0, len(keys))
+	for _, key := range keys {
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+	}
+	output, err := s.client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.config.Bucket),
+		// quiet responses list only the keys that failed
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deleting objects, %w", err)
+	}
+	if len(output.Errors) == 0 {
+		return keys, nil
+	}
+
+	failed := make(map[string]bool, len(output.Errors))
+	for _, e := range output.Errors {
+		failed[aws.StringValue(e.Key)] = true
+	}
+	deleted := make([]string, 0, len(keys)-len(failed))
+	for _, key := range keys {
+		if !failed[key] {
+			deleted = append(deleted, key)
+		}
+	}
+	first := output.Errors[0]
+
+	return deleted, fmt.Errorf("%d objects were not deleted, %s: %s", len(output.Errors), aws.StringValue(first.Key), aws.StringValue(first.Message))
+}
+
+// prefix limits the sweep to the objects foxyshot uploads, the whole bucket is never swept
+func (s *Sweeper) prefix() (string, error) {
+	tmpl, err := keytemplate.Parse(keyTemplateOf(s.config))
+	if err != nil {
+		return "", err
+	}
+	prefix := sweepPrefix(s.config, tmpl)
+	if prefix == "" {
+		return "", errors.New("no retentionPrefix, refusing to delete objects in the whole bucket")
+	}
+
+	return prefix, nil
+}
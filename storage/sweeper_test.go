@@ -0,0 +1,118 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweeper_Sweep(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	now := time.Now()
+	fake.store("shots/old.png", "old", now.Add(-48*time.Hour))
+	fake.store("shots/new.png", "new", now.Add(-time.Hour))
+	fake.store("other/old.png", "not ours", now.Add(-48*time.Hour))
+	fake.store("shots/viewer.html", "viewer", now.Add(-48*time.Hour))
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.Retention = 24 * time.Hour
+	s3Config.KeyTemplate = "shots/{uuid}.{ext}"
+	s3Config.ViewerKey = "shots/viewer.html"
+
+	deleted, err := storage.NewSweeper(s3Config, nil).Sweep(context.Background(), now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"shots/old.png"}, deleted)
+	assert.Equal(t, []string{"other/old.png", "shots/new.png", "shots/viewer.html"}, fake.keys())
+}
+
+func TestSweeper_RetentionPrefix(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	now := time.Now()
+	fake.store("2023/old.png", "old", now.Add(-48*time.Hour))
+	fake.store("archive/old.png", "old", now.Add(-48*time.Hour))
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.Retention = 24 * time.Hour
+	s3Config.KeyTemplate = "{date:2006}/{uuid}.{ext}"
+	s3Config.RetentionPrefix = "archive/"
+
+	deleted, err := storage.NewSweeper(s3Config, nil).Sweep(context.Background(), now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"archive/old.png"}, deleted)
+	assert.Equal(t, []string{"2023/old.png"}, fake.keys())
+}
+
+func TestSweeper_Batches(t *testing.T) {
+	fake := &fakeS3{protected: map[string]bool{"shots/0042.png": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	now := time.Now()
+	for i := 0; i < 1500; i++ {
+		fake.store(fmt.Sprintf("shots/%04d.png", i), "old", now.Add(-48*time.Hour))
+	}
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.Retention = 24 * time.Hour
+	s3Config.RetentionPrefix = "shots/"
+
+	deleted, err := storage.NewSweeper(s3Config, nil).Sweep(context.Background(), now)
+
+	assert.EqualError(t, err, "1 objects were not deleted, shots/0042.png: Access Denied")
+	assert.Len(t, deleted, 999, "the second batch is not sent after a failure")
+	assert.NotContains(t, deleted, "shots/0042.png")
+	assert.Equal(t, 1, fake.batchDeletes)
+
+	fake.protected = nil
+	deleted, err = storage.NewSweeper(s3Config, nil).Sweep(context.Background(), now)
+
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 501)
+	assert.Equal(t, 2, fake.batchDeletes)
+	assert.Empty(t, fake.keys())
+}
+
+func TestSweeper_NoPrefix(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	now := time.Now()
+	fake.store("old.png", "not ours", now.Add(-48*time.Hour))
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.Retention = 24 * time.Hour
+	s3Config.KeyTemplate = "{uuid}.{ext}"
+
+	deleted, err := storage.NewSweeper(s3Config, nil).Sweep(context.Background(), now)
+
+	assert.EqualError(t, err, "no retentionPrefix, refusing to delete objects in the whole bucket")
+	assert.Empty(t, deleted)
+	assert.Equal(t, []string{"old.png"}, fake.keys())
+}
+
+func TestNewSweepers(t *testing.T) {
+	c := &config.Config{Destinations: []config.Destination{
+		{Backend: config.BackendS3, S3: config.S3Config{Retention: time.Hour}},
+		{Backend: config.BackendS3},
+		{Backend: config.BackendLocal, S3: config.S3Config{Retention: time.Hour}},
+	}}
+
+	assert.Len(t, storage.NewSweepers(c, nil), 1)
+	assert.Empty(t, storage.NewSweepers(&config.Config{}, nil))
+}
@@ -2,9 +2,21 @@ package storage
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"foxyshot/config"
+	"foxyshot/storage/keytemplate"
+	"io"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -13,14 +25,110 @@ import (
 	"github.com/google/uuid"
 )
 
+// hashLength is the number of hex characters of the content hash used in keys
+const hashLength = 32
+
 // Uploader Abstract interface for uploading screenshots, other packages should not care if its s3 or gs or whatever
 type Uploader interface {
-	Upload(ctx context.Context, path string) (string, error)
+	Upload(ctx context.Context, path string, opts UploadOptions) (Result, error)
+}
+
+// UploadOptions describe the screenshot behind the uploaded file, used for object keys
+type UploadOptions struct {
+	// Path to the original screenshot, the uploaded file is usually a processed copy
+	Source string
+	// When the screenshot was taken, the time of the upload if zero
+	Taken time.Time
+}
+
+// Result describes an uploaded screenshot
+type Result struct {
+	// Link for sharing
+	URL string
+	// Identifies the file in the storage, e.g. S3 object key or file name
+	Key string
+	// Name of the destination that stored the file, empty if there is only one destination
+	Destination string
+	// When the link stops working, zero if it does not expire
+	Expires time.Time
+	// Uploads to the other destinations, only set when uploading to several destinations
+	Copies []Result
+}
+
+// New creates the Uploader for the destinations selected in config
+func New(c *config.Config) (Uploader, error) {
+	if len(c.Destinations) == 0 {
+		u, err := newDestination(&c.Destination)
+		if err != nil || c.Timeout == 0 {
+			return u, err
+		}
+
+		return namedUploader{timeout: c.Timeout, Uploader: u}, nil
+	}
+
+	destinations := make([]namedUploader, 0, len(c.Destinations))
+	primary := 0
+	for i := range c.Destinations {
+		d := &c.Destinations[i]
+		u, err := newDestination(d)
+		if err != nil {
+			return nil, fmt.Errorf("destination %d, %w", i+1, err)
+		}
+		destinations = append(destinations, namedUploader{name: destinationName(d), timeout: d.Timeout, Uploader: u})
+		if d.Primary {
+			primary = i
+		}
+	}
+
+	if c.Failover {
+		return newFailoverUploader(destinations), nil
+	}
+
+	return newMultiUploader(destinations, primary), nil
+}
+
+func newDestination(d *config.Destination) (Uploader, error) {
+	switch d.Backend {
+	case "", config.BackendS3:
+		if err := validateS3(&d.S3); err != nil {
+			return nil, err
+		}
+
+		return NewS3Uploader(&d.S3), nil
+	case config.BackendLocal:
+		return NewLocalUploader(&d.Local), nil
+	case config.BackendWebDAV:
+		return NewWebDAVUploader(&d.WebDAV), nil
+	case config.BackendSFTP:
+		return NewSFTPUploader(&d.SFTP), nil
+	case config.BackendHTTP:
+		return NewHTTPUploader(&d.HTTP), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", d.Backend)
+	}
+}
+
+func destinationName(d *config.Destination) string {
+	switch {
+	case d.Name != "":
+		return d.Name
+	case d.Backend != "":
+		return d.Backend
+	default:
+		return config.BackendS3
+	}
 }
 
 type s3CompatibleUploader struct {
 	client *s3.S3
 	config *config.S3Config
+	// cache remembers uploaded keys if Deduplicate is on
+	cache *uploadCache
+	// decoded SSECustomerKey
+	sseCustomerKey string
+	// viewerChecked is when the bucket was known to have the viewer for encrypted screenshots
+	viewerMu      sync.Mutex
+	viewerChecked time.Time
 }
 
 func newS3Client(config *config.S3Config) *s3.S3 {
@@ -44,81 +152,233 @@ func newS3Client(config *config.S3Config) *s3.S3 {
 // NewS3Uploader creates new Uploader instances compatible with S3 API ()
 func NewS3Uploader(config *config.S3Config) Uploader {
 	c := newS3Client(config)
+	u := &s3CompatibleUploader{client: c, config: config}
+	// deleted screenshots would stay in the cache, so only the bucket is asked if they are swept
+	if config.Deduplicate && config.DedupCache != "" && config.Retention == 0 {
+		u.cache = newUploadCache(config.DedupCache)
+	}
+	if config.SSECustomerKey != "" {
+		key, err := base64.StdEncoding.DecodeString(config.SSECustomerKey)
+		if err != nil {
+			log.Fatalf("Invalid SSE-C key, got %v", err)
+		}
+		u.sseCustomerKey = string(key)
+	}
 
-	return &s3CompatibleUploader{client: c, config: config}
+	return u
 }
 
 // Upload uploads file to s3 and returns presigned url
-func (u *s3CompatibleUploader) Upload(ctx context.Context, path string) (string, error) {
-	key, err := u.uploadFile(ctx, path)
+func (u *s3CompatibleUploader) Upload(ctx context.Context, path string, opts UploadOptions) (Result, error) {
+	ft, err := detectFileType(path)
 	if err != nil {
-		return "", err
+		return Result{}, err
+	}
+	var e2eKey []byte
+	original := ft
+	if u.config.Encrypt {
+		var encrypted string
+		if encrypted, e2eKey, err = encryptFile(path); err != nil {
+			return Result{}, fmt.Errorf("cannot encrypt %s, %w", path, err)
+		}
+		defer os.Remove(encrypted)
+		// the provider only sees random bytes, the type is passed to the viewer in the link
+		path, ft = encrypted, fileType{ContentType: defaultContentType, Ext: defaultExt}
+	}
+	taken := opts.Taken
+	if taken.IsZero() {
+		taken = time.Now()
+	}
+	vars := keytemplate.Vars{Time: taken, Original: opts.Source, Ext: ft.Ext}
+	key, err := u.objectKey(path, &vars)
+	if err != nil {
+		return Result{}, err
+	}
+
+	duration := u.linkDuration(vars.Original)
+	if u.config.Deduplicate && u.alreadyUploaded(ctx, key, duration) {
+		log.Printf("Skipping %s, already uploaded as %s \n", path, key)
+	} else {
+		if err := u.uploadFile(ctx, path, key, ft.ContentType, vars); err != nil {
+			return Result{}, err
+		}
+		log.Printf("Uploaded %s as %s \n", path, key)
+		u.remember(key)
 	}
-	log.Printf("Uploaded %s as %s \n", path, key)
 
-	url, err := u.generateURL(key)
+	url, err := u.generateURL(key, duration)
 	if err != nil {
-		return "", err
+		return Result{}, err
+	}
+	if e2eKey != nil {
+		if url, err = u.viewerLink(ctx, url, original.ContentType, e2eKey, duration); err != nil {
+			return Result{}, err
+		}
 	}
 
-	return url, nil
+	return Result{URL: url, Key: key, Expires: u.linkExpiry(duration)}, nil
 }
 
-func (u *s3CompatibleUploader) generateURL(key string) (string, error) {
-	if u.config.CDN != "" {
-		return u.config.CDN + "/" + key, nil
+// Presign signs a new link to the object, the object is not checked
+func (u *s3CompatibleUploader) Presign(ctx context.Context, key, previous string, duration time.Duration) (Result, error) {
+	if duration == 0 {
+		duration = u.config.Duration
+	}
+	exists, uploaded, err := u.headObject(ctx, key)
+	if err != nil {
+		return Result{}, fmt.Errorf("cannot check if %s exists, %w", key, err)
+	}
+	if !exists {
+		return Result{}, fmt.Errorf("%s does not exist in %s, it was deleted", key, u.config.Bucket)
+	}
+	// the link must not outlive the screenshot
+	if u.config.Retention > 0 {
+		left := time.Until(uploaded.Add(u.config.Retention)).Truncate(time.Second)
+		if left <= 0 {
+			return Result{}, fmt.Errorf("%s is older than retention %s and will be deleted", key, u.config.Retention)
+		}
+		if duration > left {
+			log.Printf("The link will expire after %s together with the screenshot instead of %s \n", left, duration)
+			duration = left
+		}
+	}
+	url, err := u.generateURL(key, duration)
+	if err != nil {
+		return Result{}, err
+	}
+	if u.config.Encrypt {
+		if url, err = u.renewViewerLink(ctx, url, previous, duration); err != nil {
+			return Result{}, err
+		}
 	}
 
-	if u.config.PublicURIs {
-		url := u.client.Endpoint + "/" + u.config.Bucket + "/" + key
+	return Result{URL: url, Key: key, Expires: u.linkExpiry(duration)}, nil
+}
 
-		return url, nil
+// linkDuration picks the duration of presigned links for the original screenshot from LinkDurations
+func (u *s3CompatibleUploader) linkDuration(source string) time.Duration {
+	if source == "" {
+		return u.config.Duration
 	}
 
-	return u.signURL(key)
+	name := filepath.Base(source)
+	dir := filepath.Dir(source)
+	for _, r := range u.config.LinkDurations {
+		if r.Suffix != "" && (strings.HasSuffix(name, r.Suffix) ||
+			strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), r.Suffix)) {
+			return r.Duration
+		}
+		if r.Folder != "" && isInFolder(dir, r.Folder) {
+			return r.Duration
+		}
+	}
+
+	return u.config.Duration
 }
 
-// TODO replace hardcoded content-type with config or detect automatically
-func (u *s3CompatibleUploader) uploadFile(ctx context.Context, path string) (string, error) {
-	file, err := os.Open(path)
+func isInFolder(dir, folder string) bool {
+	rel, err := filepath.Rel(filepath.Clean(folder), dir)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// linkExpiry is zero for public and CDN links
+func (u *s3CompatibleUploader) linkExpiry(duration time.Duration) time.Time {
+	if u.config.PublicURIs || u.config.CDN != "" {
+		return time.Time{}
+	}
+
+	return time.Now().Add(duration)
+}
+
+// Delete removes the object and forgets it in the dedup cache, so it can be uploaded again
+func (u *s3CompatibleUploader) Delete(ctx context.Context, key string) error {
+	_, err := u.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(u.config.Bucket),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer file.Close()
+	if u.cache != nil {
+		if err := u.cache.remove(u.cacheEntry(key)); err != nil {
+			log.Printf("Cannot remove %s from the upload cache, %v \n", key, err)
+		}
+	}
+
+	return nil
+}
 
-	key := generateObjectKey()
+func (u *s3CompatibleUploader) generateURL(key string, duration time.Duration) (string, error) {
+	if u.config.CDN != "" {
+		return u.config.CDN + "/" + escapeKey(key), nil
+	}
 
-	var acl string
 	if u.config.PublicURIs {
-		acl = "public-read"
-	} else {
-		acl = "private"
+		link := u.client.Endpoint + "/" + u.config.Bucket + "/" + escapeKey(key)
+
+		return link, nil
 	}
 
+	return u.signURL(key, duration)
+}
+
+// escapeKey escapes every segment of the key, templates can put spaces, # or ? in keys
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func (u *s3CompatibleUploader) uploadFile(ctx context.Context, path, key, contentType string, vars keytemplate.Vars) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
 	input := s3.PutObjectInput{
 		Bucket:      aws.String(u.config.Bucket),
 		Key:         aws.String(key),
 		Body:        file,
-		ACL:         aws.String(acl),
-		ContentType: aws.String("image/jpeg"),
+		ACL:         aws.String(u.acl()),
+		ContentType: aws.String(contentType),
 	}
-	output, err := u.client.PutObjectWithContext(ctx, &input)
+	if err := u.setHeaders(&input, path, vars); err != nil {
+		return err
+	}
+	u.setEncryption(&input)
+	output, err := u.putObject(ctx, &input, file)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	log.Printf("Uploaded %s, got %v \n", path, output)
 
-	return key, nil
+	return nil
+}
+
+func (u *s3CompatibleUploader) acl() string {
+	if u.config.PublicURIs {
+		return "public-read"
+	}
+
+	return "private"
 }
 
-func (u *s3CompatibleUploader) signURL(key string) (string, error) {
-	req, _ := u.client.GetObjectRequest(&s3.GetObjectInput{
+func (u *s3CompatibleUploader) signURL(key string, duration time.Duration) (string, error) {
+	input := s3.GetObjectInput{
 		Bucket: aws.String(u.config.Bucket),
 		Key:    aws.String(key),
-	})
+	}
+	// with SSE-C the key headers are signed, clients opening the link must send them
+	input.SSECustomerAlgorithm, input.SSECustomerKey = u.customerKey()
+	req, _ := u.client.GetObjectRequest(&input)
 
-	url, err := req.Presign(u.config.Duration)
+	url, err := req.Presign(duration)
 	if err != nil {
 		return "", err
 	}
@@ -126,11 +386,64 @@ func (u *s3CompatibleUploader) signURL(key string) (string, error) {
 	return url, nil
 }
 
-func generateObjectKey() string {
+// objectKey builds the key from KeyTemplate, the default template is used if it is not set
+func (u *s3CompatibleUploader) objectKey(path string, vars *keytemplate.Vars) (string, error) {
+	tmpl, err := keytemplate.Parse(keyTemplateOf(u.config))
+	if err != nil {
+		return "", err
+	}
+	if err := u.fillHash(tmpl, path, vars); err != nil {
+		return "", err
+	}
+
+	return tmpl.Execute(*vars)
+}
+
+// fillHash hashes the file only if the template needs it and it is not hashed yet
+func (u *s3CompatibleUploader) fillHash(tmpl *keytemplate.Template, path string, vars *keytemplate.Vars) error {
+	if !tmpl.Uses("hash") || vars.Hash != "" {
+		return nil
+	}
+
+	var err error
+	vars.Hash, err = hashFile(path, u.hashKey())
+
+	return err
+}
+
+// hashKey is the secret for hashes in object keys, so that keys cannot be guessed from known contents
+func (u *s3CompatibleUploader) hashKey() []byte {
+	if u.config.HashKey != "" {
+		return []byte(u.config.HashKey)
+	}
+
+	return []byte(u.config.Secret)
+}
+
+// hashFile returns HMAC-SHA256 of the contents, or plain SHA256 if there is no key
+func hashFile(path string, key []byte) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	}
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:hashLength], nil
+}
+
+func generateObjectKey(ext string) string {
 	randomUUID, err := uuid.NewRandom() // adding uuid to avoid enumeration
 	if err != nil {
 		log.Fatalf("Failed to generate uuid, got error %s\n", err)
 	}
 
-	return randomUUID.String() + ".jpg"
+	return randomUUID.String() + "." + ext
 }
@@ -2,17 +2,22 @@ package storage_test
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"foxyshot/config"
 	"foxyshot/storage"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
@@ -62,7 +67,8 @@ func Test_UploadHappyPath(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			uploader := newS3Uploader(endpoint, test.publicURIs)
 
-			url, err := uploader.Upload(ctx, f.Name())
+			uploaded, err := uploader.Upload(ctx, f.Name(), storage.UploadOptions{})
+			url := uploaded.URL
 			fmt.Println(url)
 			assert.NoError(t, err)
 
@@ -81,6 +87,161 @@ func Test_UploadHappyPath(t *testing.T) {
 	}
 }
 
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		wantErr bool
+	}{
+		{"default is s3", "", false},
+		{"s3", config.BackendS3, false},
+		{"local", config.BackendLocal, false},
+		{"unknown", "ftp", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := storage.New(&config.Config{Destination: config.Destination{Backend: tt.backend}})
+			if tt.wantErr {
+				assert.EqualError(t, err, `unknown storage backend "ftp"`)
+				assert.Nil(t, u)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, u)
+		})
+	}
+}
+
+func TestNew_Destinations(t *testing.T) {
+	c := &config.Config{Destinations: []config.Destination{
+		{Backend: config.BackendS3},
+		{Backend: config.BackendLocal, Primary: true},
+	}}
+
+	u, err := storage.New(c)
+	assert.NoError(t, err)
+	assert.NotNil(t, u)
+
+	c.Destinations = append(c.Destinations, config.Destination{Backend: "ftp"})
+	u, err = storage.New(c)
+	assert.Nil(t, u)
+	assert.EqualError(t, err, `destination 3, unknown storage backend "ftp"`)
+}
+
+func TestS3Uploader_KeyTemplate(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.KeyTemplate = "{date:2006}/{origname}-{shortid}.{ext}"
+	opts := storage.UploadOptions{Source: "/Users/foxy/Screenshot 1.png"}
+
+	uploaded, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), opts)
+
+	assert.NoError(t, err)
+	key := objectKey(t, uploaded.URL)
+	assert.Regexp(t, fmt.Sprintf(`^%d/Screenshot-1-[0-9a-zA-Z]{8}\.txt$`, time.Now().Year()), key)
+	assert.Equal(t, "/"+testBucket+"/"+key, fake.lastPath)
+}
+
+func TestS3Uploader_KeyTemplateTaken(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.KeyTemplate = "{date:2006/01}/{shortid}.{ext}"
+	opts := storage.UploadOptions{Taken: time.Date(2001, time.March, 4, 0, 0, 0, 0, time.Local)}
+
+	uploaded, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), opts)
+
+	assert.NoError(t, err)
+	assert.Regexp(t, `^2001/03/[0-9a-zA-Z]{8}\.txt$`, objectKey(t, uploaded.URL))
+}
+
+func TestS3Uploader_EscapesLinks(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{})
+	defer server.Close()
+	opts := storage.UploadOptions{Taken: time.Date(2001, time.March, 4, 0, 0, 0, 0, time.Local)}
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.KeyTemplate = "{date:Jan 2006}/{shortid}.{ext}"
+	uploaded, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), opts)
+	require.NoError(t, err)
+	assert.Regexp(t, `/`+testBucket+`/Mar%202001/[0-9a-zA-Z]{8}\.txt$`, uploaded.URL)
+	assert.Equal(t, "Mar 2001", path.Dir(uploaded.Key))
+
+	s3Config.CDN = "https://cdn.example.com"
+	uploaded, err = storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), opts)
+	require.NoError(t, err)
+	assert.Regexp(t, `^https://cdn\.example\.com/Mar%202001/[0-9a-zA-Z]{8}\.txt$`, uploaded.URL)
+}
+
+func TestS3Uploader_ContentType(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	uploaded, err := storage.NewS3Uploader(fakeS3Config(server.URL, 1, 0)).Upload(context.Background(), "../imageprocessing/testdata/valid.png", storage.UploadOptions{})
+
+	assert.NoError(t, err)
+	assert.Regexp(t, `\.png$`, objectKey(t, uploaded.URL))
+	assert.Equal(t, "image/png", fake.lastHeader.Get("Content-Type"))
+}
+
+func TestS3Uploader_Headers(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.CacheControl = "public, max-age=86400"
+	s3Config.ContentDisposition = `inline; filename="{origname}.{ext}"`
+	s3Config.Metadata = map[string]string{"original": "{origname}", "captured": "{date:2006}"}
+	opts := storage.UploadOptions{Source: "/Users/foxy/Screenshot 1.png"}
+
+	_, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), "../imageprocessing/testdata/valid.png", opts)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "public, max-age=86400", fake.lastHeader.Get("Cache-Control"))
+	assert.Equal(t, `inline; filename="Screenshot-1.png"`, fake.lastHeader.Get("Content-Disposition"))
+	assert.Equal(t, "Screenshot-1", fake.lastHeader.Get("X-Amz-Meta-Original"))
+	assert.Equal(t, strconv.Itoa(time.Now().Year()), fake.lastHeader.Get("X-Amz-Meta-Captured"))
+}
+
+func TestS3Uploader_Encryption(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.ServerSideEncryption = config.SSEKMS
+	s3Config.SSEKMSKeyId = "alias/foxyshot"
+	s3Config.StorageClass = "STANDARD_IA"
+
+	_, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "aws:kms", fake.lastHeader.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "alias/foxyshot", fake.lastHeader.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	assert.Equal(t, "STANDARD_IA", fake.lastHeader.Get("X-Amz-Storage-Class"))
+}
+
+func TestS3Uploader_SSECustomerKeyRequiresHTTPS(t *testing.T) {
+	fake := &fakeS3{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s3Config := fakeS3Config(server.URL, 1, 0)
+	s3Config.SSECustomerKey = base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	_, err := storage.NewS3Uploader(s3Config).Upload(context.Background(), createFakeUpload(t), storage.UploadOptions{})
+
+	assert.ErrorContains(t, err, "cannot send SSE keys over HTTP")
+	assert.Equal(t, 0, fake.attempts())
+}
+
 func newS3Uploader(endpoint string, publicURIs bool) storage.Uploader {
 	s3Config := &config.S3Config{
 		Key:      testUser,
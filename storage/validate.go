@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"foxyshot/config"
+	"foxyshot/storage/keytemplate"
+)
+
+// validateS3 checks the templates in the config, config does not know the placeholders
+func validateS3(c *config.S3Config) error {
+	tmpl, err := keytemplate.Parse(keyTemplateOf(c))
+	if err != nil {
+		return err
+	}
+	if c.Deduplicate && (!tmpl.Uses("hash") || tmpl.Uses("uuid") || tmpl.Uses("shortid")) {
+		return fmt.Errorf("deduplicate requires {hash} and no random ids in keyTemplate, e.g. {hash}.{ext}, got %s", keyTemplateOf(c))
+	}
+	if err := validateHeaderTemplate("cacheControl", c.CacheControl); err != nil {
+		return err
+	}
+	if err := validateHeaderTemplate("contentDisposition", c.ContentDisposition); err != nil {
+		return err
+	}
+	for name, value := range c.Metadata {
+		if err := validateHeaderTemplate("metadata "+name, value); err != nil {
+			return err
+		}
+	}
+	if c.Retention > 0 && sweepPrefix(c, tmpl) == "" {
+		return errors.New("s3 retention requires retentionPrefix or a keyTemplate starting with a folder, e.g. screenshots/{uuid}.{ext}, otherwise every old object in the bucket is deleted")
+	}
+
+	return nil
+}
+
+func validateHeaderTemplate(name, value string) error {
+	if _, err := keytemplate.ParseValue(value); err != nil {
+		return fmt.Errorf("invalid s3 %s, %w", name, err)
+	}
+
+	return nil
+}
+
+// keyTemplateOf returns KeyTemplate, the default template is used if it is not set
+func keyTemplateOf(c *config.S3Config) string {
+	if c.KeyTemplate == "" {
+		return keytemplate.Default
+	}
+
+	return c.KeyTemplate
+}
+
+// sweepPrefix limits deleting old screenshots to RetentionPrefix or the literal beginning of the key template
+func sweepPrefix(c *config.S3Config, tmpl *keytemplate.Template) string {
+	if c.RetentionPrefix != "" {
+		return c.RetentionPrefix
+	}
+
+	return tmpl.Prefix()
+}
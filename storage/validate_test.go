@@ -0,0 +1,65 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"foxyshot/config"
+	"foxyshot/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_InvalidS3(t *testing.T) {
+	tests := []struct {
+		name    string
+		s3      config.S3Config
+		wantErr string
+	}{
+		{
+			"unknown placeholder",
+			config.S3Config{KeyTemplate: "{date}/{name}.{ext}"},
+			`key template "{date}/{name}.{ext}", unknown placeholder {name}`,
+		},
+		{
+			"deduplicate without hash",
+			config.S3Config{KeyTemplate: "{uuid}.{ext}", Deduplicate: true},
+			"deduplicate requires {hash} and no random ids in keyTemplate, e.g. {hash}.{ext}, got {uuid}.{ext}",
+		},
+		{
+			"deduplicate with default template",
+			config.S3Config{Deduplicate: true},
+			"deduplicate requires {hash} and no random ids in keyTemplate, e.g. {hash}.{ext}, got {uuid}.{ext}",
+		},
+		{
+			"metadata",
+			config.S3Config{Metadata: map[string]string{"host": "{host}"}},
+			`invalid s3 metadata host, template "{host}", unknown placeholder {host}`,
+		},
+		{
+			"retention without prefix",
+			config.S3Config{KeyTemplate: "{uuid}.{ext}", Retention: 24 * time.Hour},
+			"s3 retention requires retentionPrefix or a keyTemplate starting with a folder, e.g. screenshots/{uuid}.{ext}, otherwise every old object in the bucket is deleted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := storage.New(&config.Config{Destination: config.Destination{S3: tt.s3}})
+
+			assert.Nil(t, u)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNew_RetentionPrefix(t *testing.T) {
+	for _, s3Config := range []config.S3Config{
+		{KeyTemplate: "screenshots/{uuid}.{ext}", Retention: 24 * time.Hour},
+		{RetentionPrefix: "shots/", Retention: 24 * time.Hour},
+	} {
+		u, err := storage.New(&config.Config{Destination: config.Destination{S3: s3Config}})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, u)
+	}
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"foxyshot/config"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+var errMissingCollection = errors.New("missing collection")
+
+type webdavUploader struct {
+	client *http.Client
+	config *config.WebDAVConfig
+
+	mu     sync.Mutex
+	digest *digestChallenge
+}
+
+// NewWebDAVUploader creates new Uploader instances for WebDAV servers (Nextcloud, ownCloud, Apache mod_dav etc.)
+func NewWebDAVUploader(config *config.WebDAVConfig) Uploader {
+	return &webdavUploader{client: &http.Client{}, config: config}
+}
+
+// Upload puts file into the configured folder, creating missing folders, and returns the share url
+func (u *webdavUploader) Upload(ctx context.Context, filePath string, _ UploadOptions) (Result, error) {
+	ft, err := detectFileType(filePath)
+	if err != nil {
+		return Result{}, fmt.Errorf("webdav error, %w", err)
+	}
+	key := generateObjectKey(ft.Ext)
+	target := joinURL(u.config.URL, key)
+
+	err = u.put(ctx, target, filePath, ft.ContentType)
+	if errors.Is(err, errMissingCollection) {
+		if err = u.makeCollection(ctx, u.config.URL); err != nil {
+			return Result{}, fmt.Errorf("webdav error, %w", err)
+		}
+		err = u.put(ctx, target, filePath, ft.ContentType)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("webdav error, %w", err)
+	}
+	log.Printf("Uploaded %s to %s \n", filePath, target)
+
+	return Result{URL: u.generateURL(key), Key: key}, nil
+}
+
+func (u *webdavUploader) generateURL(key string) string {
+	if u.config.PublicURL != "" {
+		return joinURL(u.config.PublicURL, key)
+	}
+
+	return joinURL(u.config.URL, key)
+}
+
+func (u *webdavUploader) put(ctx context.Context, target, filePath, contentType string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Content-Type", contentType)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(filePath)
+	}
+
+	resp, err := u.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusConflict, http.StatusNotFound:
+		return errMissingCollection
+	default:
+		return fmt.Errorf("unexpected status %s for PUT %s", resp.Status, target)
+	}
+}
+
+// Delete removes the file from the folder
+func (u *webdavUploader) Delete(ctx context.Context, key string) error {
+	target := joinURL(u.config.URL, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, target, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("webdav error, %w", err)
+	}
+	resp, err := u.do(req)
+	if err != nil {
+		return fmt.Errorf("webdav error, %w", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("webdav error, unexpected status %s for DELETE %s", resp.Status, target)
+	}
+}
+
+// makeCollection creates the folder, creating its parents first if the server reports them missing
+func (u *webdavUploader) makeCollection(ctx context.Context, collection string) error {
+	req, err := http.NewRequestWithContext(ctx, "MKCOL", collection, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := u.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMethodNotAllowed: // 405 means the folder already exists
+		return nil
+	case http.StatusConflict:
+		parent := parentURL(collection)
+		if parent == collection {
+			return fmt.Errorf("cannot create %s", collection)
+		}
+		if err := u.makeCollection(ctx, parent); err != nil {
+			return err
+		}
+
+		return u.makeCollection(ctx, collection)
+	default:
+		return fmt.Errorf("unexpected status %s for MKCOL %s", resp.Status, collection)
+	}
+}
+
+// do sends the request with credentials, answering a digest challenge if required
+func (u *webdavUploader) do(req *http.Request) (*http.Response, error) {
+	u.authorize(req)
+	resp, err := u.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || u.config.Auth != config.AuthDigest {
+		return resp, err
+	}
+
+	challenge, err := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	u.digest = challenge
+	u.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	u.authorize(retry)
+
+	return u.client.Do(retry)
+}
+
+func (u *webdavUploader) authorize(req *http.Request) {
+	if u.config.Username == "" {
+		return
+	}
+	if u.config.Auth != config.AuthDigest {
+		req.SetBasicAuth(u.config.Username, u.config.Password)
+
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.digest != nil {
+		req.Header.Set("Authorization", u.digest.authorization(req.Method, req.URL.RequestURI(), u.config.Username, u.config.Password))
+	}
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
+
+// parentURL returns the url of the parent folder, root url is returned as is
+func parentURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	dir := path.Dir(strings.TrimSuffix(parsed.Path, "/"))
+	if dir == "." {
+		return u
+	}
+	parsed.Path = strings.TrimSuffix(dir, "/") + "/"
+
+	return parsed.String()
+}
@@ -0,0 +1,165 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"foxyshot/config"
+	"foxyshot/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	davRealm = "foxyshot"
+	davNonce = "expected-nonce"
+)
+
+func TestWebDAVUploader_Upload(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	tests := []struct {
+		name string
+		auth string
+		wrap func(http.Handler) http.Handler
+	}{
+		{"basic auth", config.AuthBasic, withBasicAuth},
+		{"digest auth", config.AuthDigest, withDigestAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.wrap(newDAVHandler()))
+			defer server.Close()
+
+			uploader := storage.NewWebDAVUploader(&config.WebDAVConfig{
+				URL:       server.URL + "/files/foxy/screenshots",
+				Username:  testUser,
+				Password:  testPass,
+				Auth:      tt.auth,
+				PublicURL: "https://share.example.com/s/",
+			})
+
+			uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+			url := uploaded.URL
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(url, "https://share.example.com/s/"), url)
+
+			key := strings.TrimPrefix(url, "https://share.example.com/s/")
+			assert.Equal(t, uploadContent, getDAVFile(t, server.URL+"/files/foxy/screenshots/"+key))
+		})
+	}
+}
+
+func TestWebDAVUploader_UploadWrongCredentials(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	server := httptest.NewServer(withBasicAuth(newDAVHandler()))
+	defer server.Close()
+
+	uploader := storage.NewWebDAVUploader(&config.WebDAVConfig{
+		URL:      server.URL + "/screenshots",
+		Username: testUser,
+		Password: "wrong",
+	})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.Empty(t, url)
+	assert.ErrorContains(t, err, "webdav error, unexpected status 401 Unauthorized for PUT")
+}
+
+func TestWebDAVUploader_UploadWithoutPublicURL(t *testing.T) {
+	f, err := createUploadFile(uploadContent)
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	server := httptest.NewServer(newDAVHandler())
+	defer server.Close()
+
+	uploader := storage.NewWebDAVUploader(&config.WebDAVConfig{URL: server.URL + "/"})
+
+	uploaded, err := uploader.Upload(context.Background(), f.Name(), storage.UploadOptions{})
+	url := uploaded.URL
+	assert.NoError(t, err)
+	assert.Equal(t, uploadContent, getDAVFile(t, url))
+}
+
+func newDAVHandler() http.Handler {
+	return &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+}
+
+func getDAVFile(t *testing.T, url string) string {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	assert.NoError(t, err)
+	req.SetBasicAuth(testUser, testPass)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return string(body)
+}
+
+func withBasicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != testUser || pass != testPass {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withDigestAuth checks RFC 7616 digest responses (MD5, qop=auth), GET requests are let through
+func withDigestAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || validDigest(r) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", qop="auth,auth-int", algorithm=MD5`, davRealm, davNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+func validDigest(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(header, "Digest "), ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		params[k] = strings.Trim(v, `"`)
+	}
+
+	ha1 := md5Hex(testUser + ":" + davRealm + ":" + testPass)
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	expected := md5Hex(strings.Join([]string{ha1, davNonce, params["nc"], params["cnonce"], "auth", ha2}, ":"))
+
+	return params["username"] == testUser && params["uri"] == r.URL.RequestURI() && params["response"] == expected
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
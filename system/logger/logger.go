@@ -1,9 +1,9 @@
 package logger
 
 import (
-	"flag"
 	"fmt"
 	"log"
+	"strings"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 )
@@ -11,27 +11,45 @@ import (
 const (
 	defaultSize = 10 // megabytes
 	defaultAge  = 15 // days
+
+	logFlag = "logfile"
 )
 
-func FromArgs(args []string) {
-	logFile, err := parseLog(args)
+// FromArgs sets up logging from the -logfile flag and returns the other arguments for the subcommand
+func FromArgs(args []string) []string {
+	logFile, rest, err := parseLog(args)
 	if err != nil {
-		log.Fatal("invalid log file specified", err)
+		log.Fatal("invalid log file specified, ", err)
 	}
 	if logFile != "" {
 		setUp(logFile)
 	}
+
+	return rest
 }
 
-func parseLog(args []string) (string, error) {
-	f := flag.NewFlagSet("logger", flag.ExitOnError)
-	logFile := f.String("logfile", "", "path to file, empty means stdout")
-	err := f.Parse(args)
-	if err != nil {
-		return "", fmt.Errorf("parsing loggin args")
+// parseLog picks -logfile out of the arguments, other flags belong to subcommands and are kept
+func parseLog(args []string) (string, []string, error) {
+	logFile := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != logFlag {
+			rest = append(rest, args[i])
+
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("flag needs an argument: -%s", logFlag)
+			}
+			i++
+			value = args[i]
+		}
+		logFile = value
 	}
 
-	return *logFile, nil
+	return logFile, rest, nil
 }
 
 func setUp(file string) {
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantFile string
+		wantRest []string
+	}{
+		{"no flags", []string{"a.png"}, "", []string{"a.png"}},
+		{"separate value", []string{"-logfile", "foxy.log", "a.png"}, "foxy.log", []string{"a.png"}},
+		{"equals", []string{"--since", "24h", "--logfile=foxy.log"}, "foxy.log", []string{"--since", "24h"}},
+		{"stdin", []string{"-logfile", "foxy.log", "-"}, "foxy.log", []string{"-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logFile, rest, err := parseLog(tt.args)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantFile, logFile)
+			assert.Equal(t, tt.wantRest, rest)
+		})
+	}
+}
+
+func TestParseLog_MissingValue(t *testing.T) {
+	_, _, err := parseLog([]string{"-logfile"})
+
+	assert.EqualError(t, err, "flag needs an argument: -logfile")
+}
@@ -2,6 +2,7 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"strings"
 
 	"foxyshot/config"
+	"foxyshot/history"
+	"foxyshot/queue"
 	"foxyshot/storage"
 	"foxyshot/system/clipboard"
 	"foxyshot/system/notification"
@@ -20,12 +23,34 @@ import (
 
 // New creates dependencies and instantiates the watcher
 func New(c *config.Config) (*Watcher, error) {
-	uploader := storage.NewS3Uploader(&c.S3)
+	uploader, err := storage.New(c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create uploader, %w", err)
+	}
 	pipeline := ip.NewPipeline(c)
 	clipImpl := clipboard.New()
 	notifier := notification.NewNotifier()
 
-	return &Watcher{uploader: uploader, pipeline: pipeline, notifier: notifier, clipboardCopier: clipImpl}, nil
+	w := &Watcher{uploader: uploader, pipeline: pipeline, notifier: notifier, clipboardCopier: clipImpl}
+	if c.Queue.Enabled {
+		q, err := queue.New(c.Queue.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create upload queue, %w", err)
+		}
+		w.queue = queue.NewRetrier(q, uploader, c.Queue.RetryDelay, c.Queue.MaxDelay, w.onQueuedUploaded)
+	}
+	if c.History.Enabled {
+		recorder, err := history.NewRecorder(c)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open history, %w", err)
+		}
+		w.history = recorder
+	}
+	for _, s := range storage.NewSweepers(c, w.onSwept) {
+		w.sweepers = append(w.sweepers, s)
+	}
+
+	return w, nil
 }
 
 type notifier interface {
@@ -36,11 +61,32 @@ type clipboardCopier interface {
 	Copy(val string) error
 }
 
+type retryQueue interface {
+	Add(path, source string, uploadErr error) (*queue.Job, error)
+	Run(ctx context.Context)
+}
+
+type sweeper interface {
+	Run(ctx context.Context)
+}
+
+type historyRecorder interface {
+	RecordFile(source, processed string, uploaded storage.Result)
+	Record(source string, size int64, uploaded storage.Result)
+	RecordRemoved(keys []string)
+}
+
 type Watcher struct {
 	uploader        storage.Uploader
 	pipeline        ip.ScreenshotPipeline
 	clipboardCopier clipboardCopier
 	notifier        notifier
+	// queue is nil if failed uploads are not retried
+	queue retryQueue
+	// sweepers delete old screenshots from destinations with retention
+	sweepers []sweeper
+	// history is nil if uploads are not recorded
+	history historyRecorder
 }
 
 type fileEvent struct {
@@ -60,30 +106,101 @@ func (w *Watcher) onNewScreenshot(ctx context.Context, ei fileEvent) {
 
 		return
 	}
-	url, err := w.uploader.Upload(ctx, processed)
+	uploaded, err := w.uploader.Upload(ctx, processed, storage.UploadOptions{Source: ei.Path()})
+	// a partial error without a link means that every destination failed
+	var partial *storage.PartialError
+	if err != nil && !(errors.As(err, &partial) && uploaded.URL != "") {
+		w.queueFailed(processed, ei.Path(), err)
+
+		return
+	}
+	if w.history != nil {
+		w.history.RecordFile(ei.Path(), processed, uploaded)
+	}
+	removeProcessed(processed)
+
+	if uploaded.Destination != "" {
+		log.Printf("Url: %s (%s) \n", uploaded.URL, uploaded.Destination)
+	} else {
+		log.Printf("Url: %s \n", uploaded.URL)
+	}
+	err = w.clipboardCopier.Copy(uploaded.URL)
 	if err != nil {
-		log.Printf("Skipping %s, reason: %v\n", ei.Path(), err)
+		log.Printf("Could not copy the url to clipboard, got %v", err)
+	}
+
+	err = w.notifier.Show("FoxyShot", uploadedMessage(uploaded, partial))
+	if err != nil {
+		log.Printf("Failed to display notification, got %v", err)
+	}
+}
+
+// queueFailed keeps the processed screenshot for another attempt, it is removed if there is no queue
+func (w *Watcher) queueFailed(processed, source string, uploadErr error) {
+	if w.queue == nil {
+		log.Printf("Skipping %s, reason: %v\n", source, uploadErr)
+		removeProcessed(processed)
 
 		return
 	}
 
-	err = os.Remove(processed)
+	job, err := w.queue.Add(processed, source, uploadErr)
 	if err != nil {
-		log.Printf("Failed to remove %s, reason: %v\n", processed, err)
+		log.Printf("Skipping %s, reason: %v, cannot queue it: %v\n", source, uploadErr, err)
+		removeProcessed(processed)
+
+		return
 	}
+	log.Printf("Queued %s for retry as %s, reason: %v\n", source, job.ID, uploadErr)
 
-	log.Printf("Url: %s \n", url)
-	err = w.clipboardCopier.Copy(url)
+	err = w.notifier.Show("FoxyShot", "Upload failed, screenshot queued for retry")
 	if err != nil {
-		log.Printf("Could not copy the url to clipboard, got %v", err)
+		log.Printf("Failed to display notification, got %v", err)
+	}
+}
+
+// onSwept marks screenshots deleted after the retention period in history
+func (w *Watcher) onSwept(keys []string) {
+	if w.history != nil {
+		w.history.RecordRemoved(keys)
+	}
+}
+
+func (w *Watcher) onQueuedUploaded(job *queue.Job, uploaded storage.Result) {
+	log.Printf("Uploaded queued %s after %d attempts. Url: %s \n", job.Source, job.Attempts, uploaded.URL)
+	if w.history != nil {
+		w.history.Record(job.Source, job.Size, uploaded)
 	}
 
-	err = w.notifier.Show("FoxyShot", "Screenshot uploaded")
+	message := "Queued screenshot uploaded"
+	if uploaded.Destination != "" {
+		message += " to " + uploaded.Destination
+	}
+	err := w.notifier.Show("FoxyShot", message)
 	if err != nil {
 		log.Printf("Failed to display notification, got %v", err)
 	}
 }
 
+func removeProcessed(processed string) {
+	err := os.Remove(processed)
+	if err != nil {
+		log.Printf("Failed to remove %s, reason: %v\n", processed, err)
+	}
+}
+
+func uploadedMessage(uploaded storage.Result, partial *storage.PartialError) string {
+	message := "Screenshot uploaded"
+	if uploaded.Destination != "" {
+		message += " to " + uploaded.Destination
+	}
+	if partial != nil {
+		message += fmt.Sprintf(", %d of %d destinations failed", len(partial.Failed), partial.Total)
+	}
+
+	return message
+}
+
 func (w *Watcher) Watch(ctx context.Context, dir string) error {
 	if !strings.HasSuffix(dir, "/") {
 		dir += "/"
@@ -102,6 +219,12 @@ func (w *Watcher) Watch(ctx context.Context, dir string) error {
 	if err != nil {
 		return fmt.Errorf("cannot add screenshots directory, %w", err)
 	}
+	if w.queue != nil {
+		go w.queue.Run(ctx)
+	}
+	for _, s := range w.sweepers {
+		go s.Run(ctx)
+	}
 
 	for {
 		select {
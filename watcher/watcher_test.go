@@ -2,22 +2,59 @@ package watcher
 
 import (
 	"context"
+	"errors"
+	"io"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"foxyshot/config"
+	"foxyshot/queue"
+	"foxyshot/storage"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNew(t *testing.T) {
-	withS3 := &config.Config{S3: config.S3Config{}}
+	withS3 := &config.Config{Destination: config.Destination{S3: config.S3Config{}}}
 	app, err := New(withS3)
 
 	assert.NoError(t, err)
 	assert.IsType(t, &Watcher{}, app)
 }
 
+func TestNew_WithQueue(t *testing.T) {
+	c := &config.Config{Queue: config.QueueConfig{Enabled: true, Dir: t.TempDir()}}
+	app, err := New(c)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, app.queue)
+}
+
+func TestNew_WithRetention(t *testing.T) {
+	c := &config.Config{Destination: config.Destination{S3: config.S3Config{RetentionPrefix: "shots/", Retention: time.Hour, SweepInterval: time.Hour}}}
+	app, err := New(c)
+
+	assert.NoError(t, err)
+	assert.Len(t, app.sweepers, 1)
+}
+
+func TestNew_WithHistory(t *testing.T) {
+	c := &config.Config{History: config.HistoryConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "history.db")}}
+	app, err := New(c)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, app.history)
+}
+
+func TestNew_UnknownBackend(t *testing.T) {
+	app, err := New(&config.Config{Destination: config.Destination{Backend: "unknown"}})
+
+	assert.Nil(t, app)
+	assert.ErrorContains(t, err, "cannot create uploader")
+}
+
 func TestWatcher_WatchCancelledContext(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	testApp := initTestWatcher()
@@ -30,7 +67,7 @@ func TestWatcher_WatchCancelledContext(t *testing.T) {
 }
 
 func initTestWatcher() *Watcher {
-	withS3 := &config.Config{S3: config.S3Config{}}
+	withS3 := &config.Config{Destination: config.Destination{S3: config.S3Config{}}}
 	app, _ := New(withS3)
 
 	return app
@@ -106,6 +143,142 @@ func TestWatcher_onNewScreenshot_HappyPass(t *testing.T) {
 	assert.Equal(t, "Screenshot uploaded", system.notificationShown)
 }
 
+func TestWatcher_onNewScreenshot_RecordsHistory(t *testing.T) {
+	h := &historyMock{}
+	fa := &Watcher{uploader: &uploaderMock{}, pipeline: &pipelineMock{}, clipboardCopier: &systemMock{}, notifier: &systemMock{}, history: h}
+
+	fa.onNewScreenshot(context.Background(), fileEvent{path: "expected-path"})
+
+	assert.Equal(t, "expected-path", h.source)
+	assert.Equal(t, "expected-path-processed-uploaded", h.uploaded.URL)
+}
+
+func TestWatcher_onNewScreenshot_PartialFailure(t *testing.T) {
+	uploader := &uploaderMock{destination: "backup", err: &storage.PartialError{
+		Failed: []*storage.DestinationError{{Destination: "s3", Err: errors.New("expected error")}},
+		Total:  2,
+	}}
+	system := &systemMock{}
+	fa := &Watcher{uploader: uploader, pipeline: &pipelineMock{}, clipboardCopier: system, notifier: system}
+
+	fa.onNewScreenshot(context.Background(), fileEvent{path: "expected-path"})
+
+	assert.Equal(t, "expected-path-processed-uploaded", system.copiedToClipboard)
+	assert.Equal(t, "Screenshot uploaded to backup, 1 of 2 destinations failed", system.notificationShown)
+}
+
+func TestWatcher_onNewScreenshot_AllDestinationsFailed(t *testing.T) {
+	uploader := &uploaderMock{noURL: true, err: &storage.PartialError{
+		Failed: []*storage.DestinationError{
+			{Destination: "s3", Err: errors.New("expected error")},
+			{Destination: "backup", Err: errors.New("expected error")},
+		},
+		Total: 2,
+	}}
+	system := &systemMock{}
+	h := &historyMock{}
+	q := &queueMock{}
+	fa := &Watcher{uploader: uploader, pipeline: &pipelineMock{}, clipboardCopier: system, notifier: system, queue: q, history: h}
+
+	fa.onNewScreenshot(context.Background(), fileEvent{path: "expected-path"})
+
+	assert.Equal(t, "expected-path-processed", q.pathAdded)
+	assert.Empty(t, system.copiedToClipboard)
+	assert.Empty(t, h.source)
+	assert.Equal(t, "Upload failed, screenshot queued for retry", system.notificationShown)
+}
+
+func TestWatcher_onNewScreenshot_UploadError(t *testing.T) {
+	uploader := &uploaderMock{err: errors.New("expected error")}
+	system := &systemMock{}
+	fa := &Watcher{uploader: uploader, pipeline: &pipelineMock{}, clipboardCopier: system, notifier: system}
+
+	fa.onNewScreenshot(context.Background(), fileEvent{path: "expected-path"})
+
+	assert.Empty(t, system.copiedToClipboard)
+	assert.Empty(t, system.notificationShown)
+}
+
+func TestWatcher_onNewScreenshot_UploadErrorQueued(t *testing.T) {
+	uploader := &uploaderMock{err: errors.New("expected error")}
+	system := &systemMock{}
+	q := &queueMock{}
+	fa := &Watcher{uploader: uploader, pipeline: &pipelineMock{}, clipboardCopier: system, notifier: system, queue: q}
+
+	fa.onNewScreenshot(context.Background(), fileEvent{path: "expected-path"})
+
+	assert.Equal(t, "expected-path-processed", q.pathAdded)
+	assert.Equal(t, "expected-path", q.sourceAdded)
+	assert.Empty(t, system.copiedToClipboard)
+	assert.Equal(t, "Upload failed, screenshot queued for retry", system.notificationShown)
+}
+
+func TestWatcher_onQueuedUploaded(t *testing.T) {
+	system := &systemMock{}
+	fa := &Watcher{clipboardCopier: system, notifier: system}
+
+	fa.onQueuedUploaded(&queue.Job{Source: "expected-path"}, storage.Result{URL: "expected-url", Destination: "backup"})
+
+	assert.Empty(t, system.copiedToClipboard, "clipboard must not be overwritten by delayed uploads")
+	assert.Equal(t, "Queued screenshot uploaded to backup", system.notificationShown)
+}
+
+func TestWatcher_onQueuedUploadedRecordsHistory(t *testing.T) {
+	h := &historyMock{}
+	fa := &Watcher{clipboardCopier: &systemMock{}, notifier: &systemMock{}, history: h}
+
+	fa.onQueuedUploaded(&queue.Job{Source: "expected-path", Size: 42}, storage.Result{URL: "expected-url"})
+
+	assert.Equal(t, "expected-path", h.source)
+	assert.Equal(t, int64(42), h.size)
+	assert.Equal(t, "expected-url", h.uploaded.URL)
+}
+
+func TestWatcher_onSweptRecordsHistory(t *testing.T) {
+	h := &historyMock{}
+	fa := &Watcher{history: h}
+
+	fa.onSwept([]string{"shots/old.png"})
+	(&Watcher{}).onSwept([]string{"shots/old.png"})
+
+	assert.Equal(t, []string{"shots/old.png"}, h.removed)
+}
+
+type historyMock struct {
+	source   string
+	size     int64
+	uploaded storage.Result
+	removed  []string
+}
+
+func (h *historyMock) RecordFile(source, _ string, uploaded storage.Result) {
+	h.Record(source, 0, uploaded)
+}
+
+func (h *historyMock) RecordRemoved(keys []string) {
+	h.removed = append(h.removed, keys...)
+}
+
+func (h *historyMock) Record(source string, size int64, uploaded storage.Result) {
+	h.source = source
+	h.size = size
+	h.uploaded = uploaded
+}
+
+type queueMock struct {
+	pathAdded   string
+	sourceAdded string
+}
+
+func (q *queueMock) Add(path, source string, _ error) (*queue.Job, error) {
+	q.pathAdded = path
+	q.sourceAdded = source
+
+	return &queue.Job{ID: "expected-id"}, nil
+}
+
+func (q *queueMock) Run(_ context.Context) {}
+
 type systemMock struct {
 	copiedToClipboard string
 	notificationShown string
@@ -131,12 +304,24 @@ func (p *pipelineMock) Run(path string) (string, error) {
 	return path + "-processed", nil
 }
 
+func (p *pipelineMock) RunReader(_ io.Reader) (string, error) {
+	return "", errors.New("not used by the watcher")
+}
+
 type uploaderMock struct {
 	pathUploaded string
+	destination  string
+	err          error
+	// noURL makes partial errors fail every destination
+	noURL bool
 }
 
-func (u *uploaderMock) Upload(_ context.Context, path string) (string, error) {
+func (u *uploaderMock) Upload(_ context.Context, path string, _ storage.UploadOptions) (storage.Result, error) {
 	u.pathUploaded = path
+	var partial *storage.PartialError
+	if u.err != nil && (!errors.As(u.err, &partial) || u.noURL) {
+		return storage.Result{}, u.err
+	}
 
-	return path + "-uploaded", nil
+	return storage.Result{URL: path + "-uploaded", Destination: u.destination}, u.err
 }